@@ -13,11 +13,34 @@ import (
 
 // APIService defines the structure for an API service, containing necessary
 // components such as name, group, validator, and logger.
+//
+// WritePolicy controls how fields protected by `api:"write=..."` tags are
+// treated when the principal is not allowed to write them. NewModel returns an
+// empty model of the resource and is required when other resources include it
+// through a Relation. Parent is set on resources created with Nest. The routes
+// registered for the service are recorded to document the API and the
+// interceptors added with Use wrap the stages of all its operations. The
+// operations publish their lifecycle events to Events. Configure returns the
+// defaults of the operations and ConfigureTenant overrides settings for single
+// tenants of a multi-tenant service.
+//
+// Routes are registered on Mux, which adapts echo, net/http, chi or gin.
+// Group is only set for services created with NewAPIService.
 type APIService struct {
-	Name      string
-	Group     *echo.Group
-	Validator echo.Validator
-	Logger    echo.Logger
+	Name         string
+	Group        *echo.Group
+	Mux          Mux
+	Validator    echo.Validator
+	Logger       echo.Logger
+	WritePolicy  WritePolicy
+	NewModel     func() Model
+	Relations    []Relation
+	Parent       *ParentScope
+	Events       *EventBus
+	routes       *routeRegistry
+	interceptors *interceptorRegistry
+	tenants      *tenantRegistry
+	config       *ResourceConfig
 }
 
 // NewAPIService creates a new instance of APIService with the given parameters.
@@ -32,22 +55,53 @@ type APIService struct {
 // - *APIService: A pointer to the newly created APIService instance.
 func NewAPIService(name string, group *echo.Group, validator echo.Validator, logger echo.Logger) *APIService {
 	return &APIService{
-		Name:      name,
-		Group:     group,
-		Validator: validator,
-		Logger:    logger,
+		Name:         name,
+		Group:        group,
+		Mux:          EchoMux(group),
+		Validator:    validator,
+		Logger:       logger,
+		Events:       NewEventBus(logger),
+		routes:       &routeRegistry{},
+		interceptors: &interceptorRegistry{},
+		tenants:      &tenantRegistry{},
+		config:       &ResourceConfig{},
+	}
+}
+
+// NewAPIServiceWithMux creates an APIService registering its routes on mux,
+// for example one returned by HTTPMux.
+func NewAPIServiceWithMux(name string, mux Mux, validator echo.Validator, logger echo.Logger) *APIService {
+	return &APIService{
+		Name:         name,
+		Mux:          mux,
+		Validator:    validator,
+		Logger:       logger,
+		Events:       NewEventBus(logger),
+		routes:       &routeRegistry{},
+		interceptors: &interceptorRegistry{},
+		tenants:      &tenantRegistry{},
+		config:       &ResourceConfig{},
 	}
 }
 
+// NewHTTPAPIService creates an APIService registering its routes below prefix
+// on a net/http ServeMux.
+func NewHTTPAPIService(name string, mux *http.ServeMux, prefix string, validator echo.Validator, logger echo.Logger) *APIService {
+	return NewAPIServiceWithMux(name, HTTPMux(mux, prefix, validator), validator, logger)
+}
+
 // Create handles the creation of a new resource in the API service.
-// It performs the following steps:
-// 1. Authentication: If an authenticator is provided, it checks if the request is authenticated.
-// 2. Authorization: If an authorizer is provided, it checks if the request is authorized.
-// 3. Data Binding: It binds the request data to the provided model.
-// 4. Before Save Hook: It calls an optional before save function to perform any pre-save operations.
-// 5. Save: It saves the model to the database.
-// 6. After Save Hook: It calls an optional after save function to perform any post-save operations.
-// 7. Success Response: It returns a success response if all steps are completed without errors.
+// It runs the following stages, each wrapped by the registered interceptors:
+// 1. authenticate: If an authenticator is provided, it checks if the request is authenticated.
+// 2. authorize: If an authorizer is provided, it checks if the request is authorized.
+// 3. parent: For nested resources, it checks that the parent addressed by the route exists.
+// 4. bind: It binds the request data to the provided model, honouring field write permissions,
+// and stamps the parent id on nested resources.
+// 5. before_save: It calls an optional before save function to perform any pre-save operations.
+// 6. save: It saves the model to the database.
+// 7. after_save: It calls an optional after save function to perform any post-save operations.
+// 8. publish: It publishes a created event to the event bus of the service.
+// 9. respond: It returns a success response without the fields the principal may not read.
 //
 // Parameters:
 // - createService: A ServiceRequest struct containing the context, security handlers, form, model, and hooks.
@@ -56,73 +110,66 @@ func NewAPIService(name string, group *echo.Group, validator echo.Validator, log
 // Returns:
 // - error: An error if any step fails; otherwise, nil.
 func (createService CreateServiceRequest) Create(a APIService) error {
-	var (
-		err error
-	)
-
-	// Step 1: Authentication
-	if createService.Security.Authenticator != nil {
-		if authenticated, err := createService.Security.Authenticator(createService.Context); err != nil || !authenticated {
-			return a.ErrorResponse(createService.Context, http.StatusUnauthorized, err, "authentication failed")
-		}
-	}
-
-	// Step 2: Authorization
-	if createService.Security.Authorizer != nil {
-		if authorized, err := createService.Security.Authorizer(createService.Context); err != nil || !authorized {
-			return a.ErrorResponse(createService.Context, http.StatusForbidden, err, "authorization failed")
-		}
-	}
-
-	// Step 3: Data Binding
-	if err = BindStruct(createService.Context, createService.Form, createService.Model); err != nil {
-		return a.ErrorResponse(createService.Context, http.StatusBadRequest, err, "failed to bind form")
-	}
-
-	if err = createService.Form.Bind(createService.Model); err != nil {
-		return a.ErrorResponse(createService.Context, http.StatusBadRequest, err, "failed to bind form data")
+	defaults, enabled, err := a.operationDefaults(createService.Context, OperationCreate, createService.BaseServiceRequest, Hooks{BeforeSave: createService.BeforeSave, AfterSave: createService.AfterSave})
+	if !enabled {
+		return err
 	}
 
-	// Step 4: Before Save Hook
-	if createService.BeforeSave.Function != nil {
-		if err = createService.BeforeSave.Function(createService.Model, createService.BeforeSave.Params...); err != nil {
-			return a.ErrorResponse(createService.Context, http.StatusBadRequest, err, fmt.Sprintf("cannot use function beforesave, error : %s ", err.Error()))
-		}
+	state := &State{
+		Operation: OperationCreate,
+		Service:   &a,
+		Context:   createService.Context,
+		Security:  defaults.security,
+		Model:     createService.Model,
+		Form:      createService.Form,
 	}
 
-	// Step 5: Save the Model
-	if err = createService.Model.Save(); err != nil {
-		return a.ErrorResponse(createService.Context, http.StatusInternalServerError, err, fmt.Sprintf("cannot add %s", a.Name))
-	}
-
-	// Step 6: After Save Hook
-	if createService.AfterSave.Function != nil {
-		if err = createService.AfterSave.Function(createService.Model, createService.AfterSave.Params...); err != nil {
-			return a.ErrorResponse(createService.Context, http.StatusBadRequest, err, fmt.Sprintf("cannot use function aftersave, error : %s ", err.Error()))
-		}
-	}
-
-	// Step 7: Success Response
-	return SuccessResponse(
-		createService.Context,
-		http.StatusOK,
-		fmt.Sprintf("successfully added %s", a.Name),
-		echo.Map{a.Name: createService.Model},
-		MetaData{},
-	)
+	return a.run(state, []Stage{
+		authenticateStage(),
+		authorizeStage(),
+		parentStage(),
+		bindStage(),
+		hookStage(StageBeforeSave, defaults.hooks.BeforeSave, "beforesave"),
+		outboxStage(EventCreated, Stage{Name: StageSave, Run: func(s *State) error {
+			if err := s.Model.Save(); err != nil {
+				return NewStageError(http.StatusInternalServerError, err, fmt.Sprintf("cannot add %s", a.Name))
+			}
+			return nil
+		}}),
+		hookStage(StageAfterSave, defaults.hooks.AfterSave, "aftersave"),
+		publishStage(EventCreated),
+		{Name: StageRespond, Run: func(s *State) error {
+			data, err := a.renderValue(s.Context, s.Model, s.Model, nil, nil)
+			if err != nil {
+				return NewStageError(http.StatusInternalServerError, err, fmt.Sprintf("cannot encode %s", a.Name))
+			}
+
+			return SuccessResponse(
+				s.Context,
+				http.StatusOK,
+				fmt.Sprintf("successfully added %s", a.Name),
+				echo.Map{a.Name: data},
+				MetaData{},
+			)
+		}},
+	}, defaults.interceptors)
 }
 
 // Edit handles the editing of an existing resource in the API service.
-// It performs the following steps:
-// 1. Extract ID: Retrieves the ID of the resource to be edited from the context parameters.
-// 2. Authentication: If an authenticator is provided, it checks if the request is authenticated.
-// 3. Authorization: If an authorizer is provided, it checks if the request is authorized.
-// 4. Fetch Resource: Retrieves the existing resource by its ID.
-// 5. Data Binding: It binds the request data to the fetched model.
-// 6. Before Save Hook: It calls an optional before save function to perform any pre-save operations.
-// 7. Save: It updates the model in the database.
-// 8. After Save Hook: It calls an optional after save function to perform any post-save operations.
-// 9. Success Response: It returns a success response if all steps are completed without errors.
+// The ID of the resource is taken from the route, then it runs the following
+// stages, each wrapped by the registered interceptors:
+// 1. authenticate: If an authenticator is provided, it checks if the request is authenticated.
+// 2. authorize: If an authorizer is provided, it checks if the request is authorized.
+// 3. parent: For nested resources, it checks that the parent addressed by the route exists.
+// 4. fetch: Retrieves the existing resource by its ID; resources of another parent are not found.
+// The fetched resource is kept as the before snapshot of the updated event.
+// 5. bind: It binds the request data to the fetched model, honouring field write permissions;
+// nested resources keep the parent of the route.
+// 6. before_save: It calls an optional before save function to perform any pre-save operations.
+// 7. save: It updates the model in the database.
+// 8. after_save: It calls an optional after save function to perform any post-save operations.
+// 9. publish: It publishes an updated event to the event bus of the service.
+// 10. respond: It returns a success response without the fields the principal may not read.
 //
 // Parameters:
 // - updateService: A ServiceRequest struct containing the context, security handlers, form, model, and hooks.
@@ -131,72 +178,73 @@ func (createService CreateServiceRequest) Create(a APIService) error {
 // Returns:
 // - error: An error if any step fails; otherwise, nil.
 func (updateService UpdateServiceRequest) Edit(a APIService) error {
-	var (
-		err error
-	)
-
-	// Step 1: Extract ID
-	id := updateService.Context.Param("id")
-
-	// Step 2: Authentication
-	if updateService.Security.Authenticator != nil {
-		if authenticated, err := updateService.Security.Authenticator(updateService.Context); err != nil || !authenticated {
-			return a.ErrorResponse(updateService.Context, http.StatusUnauthorized, err, "authentication failed")
-		}
-	}
-
-	// Step 3: Authorization
-	if updateService.Security.Authorizer != nil {
-		if authorized, err := updateService.Security.Authorizer(updateService.Context); err != nil || !authorized {
-			return a.ErrorResponse(updateService.Context, http.StatusForbidden, err, "authorization failed")
-		}
-	}
-
-	// Step 4: Fetch Resource
-	if err = updateService.Model.GetOne(id); err != nil {
-		return a.ErrorResponse(updateService.Context, http.StatusBadRequest, err, fmt.Sprintf("cannot find any %s", a.Name))
-	}
-
-	// Step 5: Data Binding
-	if err = BindStruct(updateService.Context, updateService.Form, updateService.Model); err != nil {
-		return a.ErrorResponse(updateService.Context, http.StatusBadRequest, err, "failed to bind form")
-	}
-
-	if err = updateService.Form.Bind(updateService.Model); err != nil {
-		return a.ErrorResponse(updateService.Context, http.StatusBadRequest, err, "failed to bind form data")
+	defaults, enabled, err := a.operationDefaults(updateService.Context, OperationEdit, updateService.BaseServiceRequest, Hooks{BeforeSave: updateService.BeforeSave, AfterSave: updateService.AfterSave})
+	if !enabled {
+		return err
 	}
 
-	// Step 6: Before Save Hook
-	if updateService.BeforeSave.Function != nil {
-		if err = updateService.BeforeSave.Function(updateService.Model, updateService.BeforeSave.Params...); err != nil {
-			return a.ErrorResponse(updateService.Context, http.StatusBadRequest, err, fmt.Sprintf("cannot use function beforesave, error : %s ", err.Error()))
-		}
+	state := &State{
+		Operation: OperationEdit,
+		Service:   &a,
+		Context:   updateService.Context,
+		Security:  defaults.security,
+		Model:     updateService.Model,
+		Form:      updateService.Form,
+		ID:        updateService.Context.Param("id"),
 	}
 
-	// Step 7: Save the Model
-	if err = updateService.Model.Save(); err != nil {
-		return a.ErrorResponse(updateService.Context, http.StatusInternalServerError, err, fmt.Sprintf("cannot edit %s", a.Name))
-	}
-
-	// Step 8: After Save Hook
-	if updateService.AfterSave.Function != nil {
-		if err = updateService.AfterSave.Function(updateService.Model, updateService.AfterSave.Params...); err != nil {
-			return a.ErrorResponse(updateService.Context, http.StatusBadRequest, err, fmt.Sprintf("cannot use function aftersave, error : %s ", err.Error()))
-		}
-	}
-
-	// Step 9: Success Response
-	return SuccessResponse(updateService.Context, http.StatusOK, fmt.Sprintf("successfully edited %s", a.Name), echo.Map{a.Name: updateService.Model}, MetaData{})
+	fetch := fetchStage()
+	return a.run(state, []Stage{
+		authenticateStage(),
+		authorizeStage(),
+		parentStage(),
+		{Name: StageFetch, Run: func(s *State) error {
+			if err := fetch.Run(s); err != nil {
+				return err
+			}
+
+			if defaults.hooks.BeforeSave.Hook != nil || defaults.hooks.AfterSave.Hook != nil {
+				old, err := a.cloneModel(s.Model)
+				if err != nil {
+					return NewStageError(http.StatusInternalServerError, err, fmt.Sprintf("cannot copy %s", a.Name))
+				}
+				s.old = old
+			}
+			return s.snapshotBefore(EventUpdated)
+		}},
+		bindStage(),
+		hookStage(StageBeforeSave, defaults.hooks.BeforeSave, "beforesave"),
+		outboxStage(EventUpdated, Stage{Name: StageSave, Run: func(s *State) error {
+			if err := s.Model.Save(); err != nil {
+				return NewStageError(http.StatusInternalServerError, err, fmt.Sprintf("cannot edit %s", a.Name))
+			}
+			return nil
+		}}),
+		hookStage(StageAfterSave, defaults.hooks.AfterSave, "aftersave"),
+		publishStage(EventUpdated),
+		{Name: StageRespond, Run: func(s *State) error {
+			data, err := a.renderValue(s.Context, s.Model, s.Model, nil, nil)
+			if err != nil {
+				return NewStageError(http.StatusInternalServerError, err, fmt.Sprintf("cannot encode %s", a.Name))
+			}
+
+			return SuccessResponse(s.Context, http.StatusOK, fmt.Sprintf("successfully edited %s", a.Name), echo.Map{a.Name: data}, MetaData{})
+		}},
+	}, defaults.interceptors)
 }
 
 // View handles retrieving a single model.
-// It performs the following steps:
-// 1. Extract ID: Retrieves the ID of the model to be viewed from the context parameters.
-// 2. Authentication: If an authenticator is provided, it checks if the request is authenticated.
-// 3. Authorization: If an authorizer is provided, it checks if the request is authorized.
-// 4. Retrieve Model: It retrieves the model from the database using its ID.
-// 5. After Find Hook: It calls an optional after find function to perform any post-find operations.
-// 6. Success Response: It returns a success response with the retrieved model.
+// The ID of the model is taken from the route, then it runs the following
+// stages, each wrapped by the registered interceptors:
+// 1. authenticate: If an authenticator is provided, it checks if the request is authenticated.
+// 2. authorize: If an authorizer is provided, it checks if the request is authorized.
+// 3. parent: For nested resources, it checks that the parent addressed by the route exists.
+// 4. select: It validates the optional fields and include query parameters.
+// 5. fetch: It retrieves the model from the database using its ID; models of another parent are not found.
+// 6. after_find: It calls an optional after find function to perform any post-find operations.
+// 7. publish: It publishes a viewed event to the event bus of the service.
+// 8. respond: It returns a success response with the readable, selected fields of the model
+// and the included related resources.
 //
 // Parameters:
 // - viewService: A ViewServiceRequest struct containing the context, model, security handlers, and after find hook.
@@ -205,107 +253,120 @@ func (updateService UpdateServiceRequest) Edit(a APIService) error {
 // Returns:
 // - error: An error if any step fails; otherwise, nil.
 func (viewService ViewServiceRequest) View(a APIService) error {
-	var (
-		err error
-	)
-
-	// Step 1: Extract ID
-	id := viewService.Context.Param("id")
-
-	// Step 2: Authentication
-	if viewService.Security.Authenticator != nil {
-		if authenticated, err := viewService.Security.Authenticator(viewService.Context); err != nil || !authenticated {
-			return a.ErrorResponse(viewService.Context, http.StatusUnauthorized, err, "authentication failed")
-		}
-	}
-
-	// Step 3: Authorization
-	if viewService.Security.Authorizer != nil {
-		if authorized, err := viewService.Security.Authorizer(viewService.Context); err != nil || !authorized {
-			return a.ErrorResponse(viewService.Context, http.StatusForbidden, err, "authorization failed")
-		}
-	}
-
-	// Step 4: Retrieve Model
-	if err = viewService.Model.GetOne(id); err != nil {
-		return a.ErrorResponse(viewService.Context, http.StatusBadRequest, err, fmt.Sprintf("cannot find any %s", a.Name))
+	defaults, enabled, err := a.operationDefaults(viewService.Context, OperationView, viewService.BaseServiceRequest, Hooks{AfterFind: viewService.AfterFind})
+	if !enabled {
+		return err
 	}
 
-	// Step 5: After Find Hook
-	if viewService.AfterFind.Function != nil {
-		if err = viewService.AfterFind.Function(viewService.Model, viewService.AfterFind.Params...); err != nil {
-			return a.ErrorResponse(viewService.Context, http.StatusBadRequest, err, fmt.Sprintf("cannot use function after find, error : %s ", err.Error()))
-		}
+	state := &State{
+		Operation: OperationView,
+		Service:   &a,
+		Context:   viewService.Context,
+		Security:  defaults.security,
+		Model:     viewService.Model,
+		ID:        viewService.Context.Param("id"),
 	}
 
-	// Step 6: Success Response
-	return SuccessResponse(viewService.Context, http.StatusOK, fmt.Sprintf("successfully loaded %s", a.Name), echo.Map{a.Name: viewService.Model}, MetaData{})
+	return a.run(state, []Stage{
+		authenticateStage(),
+		authorizeStage(),
+		parentStage(),
+		selectStage(),
+		fetchStage(),
+		hookStage(StageAfterFind, defaults.hooks.AfterFind, "after find"),
+		publishStage(EventViewed),
+		{Name: StageRespond, Run: func(s *State) error {
+			data, err := a.renderValue(s.Context, s.Model, s.Model, s.Fields, s.Includes)
+			if err != nil {
+				return NewStageError(http.StatusInternalServerError, err, fmt.Sprintf("cannot encode %s", a.Name))
+			}
+
+			return SuccessResponse(s.Context, http.StatusOK, fmt.Sprintf("successfully loaded %s", a.Name), echo.Map{a.Name: data}, MetaData{})
+		}},
+	}, defaults.interceptors)
 }
 
 // List handles listing models with pagination and filtering.
+// The optional fields query parameter limits every listed model to the selected fields
+// and the include query parameter embeds related resources, loaded in one batch per relation.
+// Nested resources only list the records of the parent addressed by the route.
+// Its stages are paginate, authenticate, authorize, parent, filter, select,
+// before_list, list, after_list, publish and respond; publish sends a listed event.
 func (listService ListServiceRequest) List(a APIService) error {
-	var (
-		err error
-	)
-
-	pfilter, _ := SetPagination(listService.Context)
-
-	if listService.Security.Authenticator != nil {
-		if authenticated, err := listService.Security.Authenticator(listService.Context); err != nil || !authenticated {
-			return a.ErrorResponse(listService.Context, http.StatusUnauthorized, err, "authentication failed")
-		}
-	}
-
-	// Step 3: Authorization
-	if listService.Security.Authorizer != nil {
-		if authorized, err := listService.Security.Authorizer(listService.Context); err != nil || !authorized {
-			return a.ErrorResponse(listService.Context, http.StatusForbidden, err, "authorization failed")
-		}
+	defaults, enabled, err := a.operationDefaults(listService.Context, OperationList, listService.BaseServiceRequest, Hooks{BeforeList: listService.BeforeGetList, AfterList: listService.AfterGetList})
+	if !enabled {
+		return err
 	}
 
-	if err := listService.Context.Bind(listService.Filters); err != nil {
-		return a.ErrorResponse(listService.Context, http.StatusBadRequest, err, fmt.Sprintf("cannot bind %s filter", a.Name))
+	state := &State{
+		Operation: OperationList,
+		Service:   &a,
+		Context:   listService.Context,
+		Security:  defaults.security,
+		Model:     listService.Model,
 	}
 
-	if listService.BeforeGetList.Function != nil {
-		if err = listService.BeforeGetList.Function(listService.Model, listService.BeforeGetList.Params...); err != nil {
-			return a.ErrorResponse(listService.Context, http.StatusBadRequest, err, fmt.Sprintf("cannot use function before get list, error : %s ", err.Error()))
-		}
-	}
-
-	totalCounts, totalPages, list, err := listService.Model.List(listService.Filters, pfilter)
-	if err != nil {
-		return a.ErrorResponse(listService.Context, http.StatusBadRequest, err, fmt.Sprintf("cannot find any %s", a.Name))
-	}
-
-	if listService.AfterGetList.Function != nil {
-		if err = listService.AfterGetList.Function(listService.Model, listService.AfterGetList.Params...); err != nil {
-			return a.ErrorResponse(listService.Context, http.StatusBadRequest, err, fmt.Sprintf("cannot use function after get list, error : %s ", err.Error()))
-		}
-	}
-
-	return SuccessResponse(listService.Context, http.StatusOK, fmt.Sprintf("successfully loaded %s list", a.Name), echo.Map{
-		a.Name + "s":   list,
-		"total_counts": totalCounts,
-		"total_pages":  totalPages,
-	}, MetaData{
-		Limit:       pfilter.Limit,
-		CurrentPage: pfilter.Page,
-		TotalCounts: totalCounts,
-		TotalPages:  totalPages,
-		Sort:        pfilter.Sort,
-	})
+	return a.run(state, []Stage{
+		{Name: StagePaginate, Run: func(s *State) error {
+			s.Pagination, _ = defaults.pagination.Paginate(s.Context)
+			return nil
+		}},
+		authenticateStage(),
+		authorizeStage(),
+		parentStage(),
+		{Name: StageFilter, Run: func(s *State) error {
+			if err := s.Context.Bind(listService.Filters); err != nil {
+				return NewStageError(http.StatusBadRequest, err, fmt.Sprintf("cannot bind %s filter", a.Name))
+			}
+			s.Filter = a.scopeFilter(listService.Filters, s.ParentID)
+			return nil
+		}},
+		selectStage(),
+		hookStage(StageBeforeList, defaults.hooks.BeforeList, "before get list"),
+		{Name: StageList, Run: func(s *State) error {
+			totalCounts, totalPages, list, err := s.Model.List(s.Filter, s.Pagination)
+			if err != nil {
+				return NewStageError(http.StatusBadRequest, err, fmt.Sprintf("cannot find any %s", a.Name))
+			}
+			s.TotalCounts, s.TotalPages, s.List = totalCounts, totalPages, list
+			return nil
+		}},
+		hookStage(StageAfterList, defaults.hooks.AfterList, "after get list"),
+		publishStage(EventListed),
+		{Name: StageRespond, Run: func(s *State) error {
+			list, err := a.renderValue(s.Context, s.List, s.Model, s.Fields, s.Includes)
+			if err != nil {
+				return NewStageError(http.StatusInternalServerError, err, fmt.Sprintf("cannot encode %s list", a.Name))
+			}
+
+			return SuccessResponse(s.Context, http.StatusOK, fmt.Sprintf("successfully loaded %s list", a.Name), echo.Map{
+				a.Name + "s":   list,
+				"total_counts": s.TotalCounts,
+				"total_pages":  s.TotalPages,
+			}, MetaData{
+				Limit:       s.Pagination.Limit,
+				CurrentPage: s.Pagination.Page,
+				TotalCounts: s.TotalCounts,
+				TotalPages:  s.TotalPages,
+				Sort:        s.Pagination.Sort,
+			})
+		}},
+	}, defaults.interceptors)
 }
 
 // Delete handles deleting a model.
-// It performs the following steps:
-// 1. Extract ID: Retrieves the ID of the model to be deleted from the context parameters.
-// 2. Authentication: If an authenticator is provided, it checks if the request is authenticated.
-// 3. Authorization: If an authorizer is provided, it checks if the request is authorized.
-// 4. Before Remove Hook: It calls an optional before remove function to perform any pre-remove operations.
-// 5. Remove Model: It removes the model from the database.
-// 6. After Remove Hook: It calls an optional after remove function to perform any post-remove operations.
-// 7. Success Response: It returns a success response if the model is successfully removed.
+// The ID of the model is taken from the route, then it runs the following
+// stages, each wrapped by the registered interceptors:
+// 1. authenticate: If an authenticator is provided, it checks if the request is authenticated.
+// 2. authorize: If an authorizer is provided, it checks if the request is authorized.
+// 3. parent: For nested resources, it checks that the parent addressed by the route exists.
+// 4. fetch: For nested resources, it checks that the model belongs to the parent.
+// The model is loaded as the before snapshot of the deleted event when it has subscribers.
+// 5. before_remove: It calls an optional before remove function to perform any pre-remove operations.
+// 6. remove: It removes the model from the database.
+// 7. after_remove: It calls an optional after remove function to perform any post-remove operations.
+// 8. publish: It publishes a deleted event to the event bus of the service.
+// 9. respond: It returns a success response if the model is successfully removed.
 //
 // Parameters:
 // - deleteService: A DeleteServiceRequest struct containing the context, model, security handlers, and hooks.
@@ -314,46 +375,49 @@ func (listService ListServiceRequest) List(a APIService) error {
 // Returns:
 // - error: An error if any step fails; otherwise, nil.
 func (deleteService DeleteServiceRequest) Delete(a APIService) error {
-	var (
-		err error
-	)
-
-	// Step 1: Extract ID
-	id := deleteService.Context.Param("id")
-
-	// Step 2: Authentication
-	if deleteService.Security.Authenticator != nil {
-		if authenticated, err := deleteService.Security.Authenticator(deleteService.Context); err != nil || !authenticated {
-			return a.ErrorResponse(deleteService.Context, http.StatusUnauthorized, err, "authentication failed")
-		}
-	}
-
-	// Step 3: Authorization
-	if deleteService.Security.Authorizer != nil {
-		if authorized, err := deleteService.Security.Authorizer(deleteService.Context); err != nil || !authorized {
-			return a.ErrorResponse(deleteService.Context, http.StatusForbidden, err, "authorization failed")
-		}
-	}
-
-	// Step 4: Before Remove Hook
-	if deleteService.BeforeRemove.Function != nil {
-		if err = deleteService.BeforeRemove.Function(deleteService.Model, deleteService.BeforeRemove.Params...); err != nil {
-			return a.ErrorResponse(deleteService.Context, http.StatusBadRequest, err, fmt.Sprintf("cannot use function before remove, error : %s ", err.Error()))
-		}
-	}
-
-	// Step 5: Remove Model
-	if err = deleteService.Model.Remove(id); err != nil {
-		return a.ErrorResponse(deleteService.Context, http.StatusBadRequest, err, fmt.Sprintf("cannot find any %s", a.Name))
+	defaults, enabled, err := a.operationDefaults(deleteService.Context, OperationDelete, deleteService.BaseServiceRequest, Hooks{BeforeRemove: deleteService.BeforeRemove, AfterRemove: deleteService.AfterRemove})
+	if !enabled {
+		return err
 	}
 
-	// Step 6: After Remove Hook
-	if deleteService.AfterRemove.Function != nil {
-		if err = deleteService.AfterRemove.Function(deleteService.Model, deleteService.AfterRemove.Params...); err != nil {
-			return a.ErrorResponse(deleteService.Context, http.StatusBadRequest, err, fmt.Sprintf("cannot use function after remove, error : %s ", err.Error()))
-		}
+	state := &State{
+		Operation: OperationDelete,
+		Service:   &a,
+		Context:   deleteService.Context,
+		Security:  defaults.security,
+		Model:     deleteService.Model,
+		ID:        deleteService.Context.Param("id"),
 	}
 
-	// Step 7: Success Response
-	return SuccessResponse(deleteService.Context, http.StatusOK, "successfully removed", nil, MetaData{})
+	fetch := fetchStage()
+	return a.run(state, []Stage{
+		authenticateStage(),
+		authorizeStage(),
+		parentStage(),
+		{Name: StageFetch, Run: func(s *State) error {
+			if a.Parent != nil {
+				if err := fetch.Run(s); err != nil {
+					return err
+				}
+			} else if a.Events.Wants(EventDeleted) {
+				// the model is only loaded to describe the deleted record
+				if err := s.fetch(); err != nil {
+					return nil
+				}
+			}
+			return s.snapshotBefore(EventDeleted)
+		}},
+		hookStage(StageBeforeRemove, defaults.hooks.BeforeRemove, "before remove"),
+		outboxStage(EventDeleted, Stage{Name: StageRemove, Run: func(s *State) error {
+			if err := s.Model.Remove(s.ID); err != nil {
+				return NewStageError(http.StatusBadRequest, err, fmt.Sprintf("cannot find any %s", a.Name))
+			}
+			return nil
+		}}),
+		hookStage(StageAfterRemove, defaults.hooks.AfterRemove, "after remove"),
+		publishStage(EventDeleted),
+		{Name: StageRespond, Run: func(s *State) error {
+			return SuccessResponse(s.Context, http.StatusOK, "successfully removed", nil, MetaData{})
+		}},
+	}, defaults.interceptors)
 }
@@ -0,0 +1,490 @@
+package apimaker
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// apiKeyKey is the context key the authenticated API key is stored under.
+const apiKeyKey = "apimaker.apikey"
+
+// ErrAPIKeyNotFound is returned by an APIKeyStore for unknown keys.
+var ErrAPIKeyNotFound = errors.New("api key not found")
+
+// APIKey describes an issued key. Only the SHA-256 hash of the key is stored;
+// the key itself is returned once, when it is issued.
+type APIKey struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Prefix string `json:"prefix"`
+	Hash   string `json:"-"`
+	// Scopes are permissions like those of RBACPolicy: "resource:operation"
+	// pairs, either of which may be "*".
+	Scopes []string `json:"scopes"`
+	// Subject and Roles make up the principal of the requests using the key;
+	// Subject defaults to the key ID.
+	Subject    string     `json:"subject,omitempty"`
+	Roles      []string   `json:"roles,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	// RotatedFrom is the ID of the key this one replaced.
+	RotatedFrom string    `json:"rotated_from,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Active reports whether the key may be used at t.
+func (k *APIKey) Active(t time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || t.Before(*k.ExpiresAt))
+}
+
+// Allows reports whether a scope of the key covers the operation of resource.
+func (k *APIKey) Allows(resource string, operation Operation) bool {
+	for _, scope := range k.Scopes {
+		if permissionAllows(scope, resource, operation) {
+			return true
+		}
+	}
+	return false
+}
+
+// APIKeyStore persists API keys.
+type APIKeyStore interface {
+	SaveKey(key *APIKey) error
+	GetKey(id string) (*APIKey, error)
+	FindKeyByHash(hash string) (*APIKey, error)
+	ListKeys() ([]*APIKey, error)
+	// TouchKey records that the key was used at t.
+	TouchKey(id string, t time.Time) error
+}
+
+// MemoryAPIKeyStore is an APIKeyStore kept in memory.
+type MemoryAPIKeyStore struct {
+	mu     sync.RWMutex
+	keys   map[string]APIKey
+	hashes map[string]string
+}
+
+// NewMemoryAPIKeyStore creates an empty MemoryAPIKeyStore.
+func NewMemoryAPIKeyStore() *MemoryAPIKeyStore {
+	return &MemoryAPIKeyStore{keys: map[string]APIKey{}, hashes: map[string]string{}}
+}
+
+func (s *MemoryAPIKeyStore) SaveKey(key *APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[key.ID] = *key
+	s.hashes[key.Hash] = key.ID
+	return nil
+}
+
+func (s *MemoryAPIKeyStore) GetKey(id string) (*APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	key, ok := s.keys[id]
+	if !ok {
+		return nil, ErrAPIKeyNotFound
+	}
+	return &key, nil
+}
+
+func (s *MemoryAPIKeyStore) FindKeyByHash(hash string) (*APIKey, error) {
+	s.mu.RLock()
+	id, ok := s.hashes[hash]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, ErrAPIKeyNotFound
+	}
+	return s.GetKey(id)
+}
+
+func (s *MemoryAPIKeyStore) ListKeys() ([]*APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys := []*APIKey{}
+	for _, key := range s.keys {
+		key := key
+		keys = append(keys, &key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].CreatedAt.Before(keys[j].CreatedAt) })
+	return keys, nil
+}
+
+func (s *MemoryAPIKeyStore) TouchKey(id string, t time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.keys[id]
+	if !ok {
+		return ErrAPIKeyNotFound
+	}
+	key.LastUsedAt = &t
+	s.keys[id] = key
+	return nil
+}
+
+// APIKeys authenticates requests with API keys and manages them. Its
+// authenticator rejects the operations the scopes of the key do not cover.
+// It is also an Interceptor checking the scopes again at the authorize stage,
+// for services whose authenticator accepts API keys among other credentials.
+type APIKeys struct {
+	Store APIKeyStore
+	// Header carries the key, X-API-Key by default. "Authorization: ApiKey <key>"
+	// is accepted as well.
+	Header string
+	// RotationOverlap is how long a rotated key keeps working, 24 hours by default.
+	RotationOverlap time.Duration
+	Logger          echo.Logger
+}
+
+// NewAPIKeys creates an APIKeys using store.
+func NewAPIKeys(store APIKeyStore) *APIKeys {
+	return &APIKeys{Store: store, Header: "X-API-Key", RotationOverlap: 24 * time.Hour}
+}
+
+// GetAPIKey returns the API key the request was authenticated with, if any.
+func GetAPIKey(c Context) *APIKey {
+	key, _ := c.Get(apiKeyKey).(*APIKey)
+	return key
+}
+
+// HashAPIKey returns the hash stored for a key.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Authenticator returns an authenticator accepting active keys whose scopes
+// cover the operation of the request, as told by RequestOperation; other keys
+// are answered with 403. It records when the key was used and stores a
+// principal with the subject and roles of the key, and its ID and scopes as
+// the api_key and scopes claims.
+func (k *APIKeys) Authenticator() func(c Context) (bool, error) {
+	return func(c Context) (bool, error) {
+		raw := k.token(c.Request())
+		if raw == "" {
+			return false, errors.New("missing api key")
+		}
+
+		key, err := k.Store.FindKeyByHash(HashAPIKey(raw))
+		if err != nil {
+			if errors.Is(err, ErrAPIKeyNotFound) {
+				return false, errors.New("invalid api key")
+			}
+			return false, err
+		}
+
+		now := time.Now().UTC()
+		if !key.Active(now) {
+			return false, errors.New("api key expired or revoked")
+		}
+
+		if resource, operation := RequestOperation(c); !key.Allows(resource, operation) {
+			return false, NewStageError(http.StatusForbidden, fmt.Errorf("api key scopes do not allow %s:%s", resource, operation), "authorization failed")
+		}
+
+		if err := k.Store.TouchKey(key.ID, now); err != nil {
+			return false, err
+		}
+
+		subject := key.Subject
+		if subject == "" {
+			subject = key.ID
+		}
+		c.Set(apiKeyKey, key)
+		SetPrincipal(c, &Principal{
+			ID:     subject,
+			Roles:  key.Roles,
+			Claims: map[string]interface{}{"api_key": key.ID, "scopes": key.Scopes},
+		})
+		return true, nil
+	}
+}
+
+func (k *APIKeys) token(r *http.Request) string {
+	header := k.Header
+	if header == "" {
+		header = "X-API-Key"
+	}
+	if key := r.Header.Get(header); key != "" {
+		return key
+	}
+
+	scheme, key, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if found && strings.EqualFold(scheme, "ApiKey") {
+		return strings.TrimSpace(key)
+	}
+	return ""
+}
+
+// Intercept checks the scopes of the API key before the authorize stage. The
+// authenticator already does, so it is only needed when the key was stored
+// by another authenticator.
+func (k *APIKeys) Intercept(s *State, stage string, next func() error) error {
+	if stage == StageAuthorize {
+		if key := GetAPIKey(s.Context); key != nil && !key.Allows(s.Service.Name, s.Operation) {
+			return NewStageError(http.StatusForbidden, fmt.Errorf("api key scopes do not allow %s:%s", s.Service.Name, s.Operation), "authorization failed")
+		}
+	}
+	return next()
+}
+
+// Issue creates a key and returns it with its plain value, which cannot be
+// retrieved later.
+func (k *APIKeys) Issue(key APIKey) (*APIKey, string, error) {
+	if err := checkScopes(key.Scopes); err != nil {
+		return nil, "", err
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", err
+	}
+
+	key.ID = newEventID()
+	key.Prefix = "ak_" + key.ID[:8]
+	raw := key.Prefix + "_" + base64.RawURLEncoding.EncodeToString(secret)
+	key.Hash = HashAPIKey(raw)
+	key.RevokedAt, key.LastUsedAt = nil, nil
+	key.CreatedAt = time.Now().UTC()
+
+	if err := k.Store.SaveKey(&key); err != nil {
+		return nil, "", err
+	}
+	return &key, raw, nil
+}
+
+// Revoke disables a key immediately.
+func (k *APIKeys) Revoke(id string) error {
+	key, err := k.Store.GetKey(id)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	key.RevokedAt = &now
+	return k.Store.SaveKey(key)
+}
+
+// Rotate issues a key with the settings of an active key, which then expires
+// after overlap, or RotationOverlap when overlap is not positive.
+func (k *APIKeys) Rotate(id string, overlap time.Duration) (*APIKey, string, error) {
+	old, err := k.Store.GetKey(id)
+	if err != nil {
+		return nil, "", err
+	}
+	if !old.Active(time.Now()) {
+		return nil, "", errors.New("api key expired or revoked")
+	}
+
+	key, raw, err := k.Issue(APIKey{
+		Name:        old.Name,
+		Scopes:      old.Scopes,
+		Subject:     old.Subject,
+		Roles:       old.Roles,
+		ExpiresAt:   old.ExpiresAt,
+		RotatedFrom: old.ID,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	if overlap <= 0 {
+		overlap = k.RotationOverlap
+	}
+	expires := time.Now().Add(overlap).UTC()
+	if old.ExpiresAt == nil || expires.Before(*old.ExpiresAt) {
+		old.ExpiresAt = &expires
+	}
+	if err := k.Store.SaveKey(old); err != nil {
+		return nil, "", err
+	}
+	return key, raw, nil
+}
+
+// checkDelegation returns an error when a request authenticated with caller
+// would give key more than caller has: a scope caller does not cover, a role
+// caller lacks or another subject. Requests not made with an API key are
+// not restricted.
+func checkDelegation(caller *APIKey, key *APIKey) error {
+	if caller == nil {
+		return nil
+	}
+
+	for _, scope := range key.Scopes {
+		covered := false
+		for _, granted := range caller.Scopes {
+			if permissionCovers(granted, scope) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return fmt.Errorf("api key scopes do not cover %s", scope)
+		}
+	}
+
+	for _, role := range key.Roles {
+		found := false
+		for _, granted := range caller.Roles {
+			if granted == role {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("api key lacks the role %s", role)
+		}
+	}
+
+	subject := caller.Subject
+	if subject == "" {
+		subject = caller.ID
+	}
+	if key.Subject != "" && key.Subject != subject {
+		return fmt.Errorf("api key cannot act for subject %s", key.Subject)
+	}
+	return nil
+}
+
+func checkScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return errors.New("api key needs at least one scope")
+	}
+	for _, scope := range scopes {
+		resource, operation, found := strings.Cut(scope, ":")
+		if !found || resource == "" || operation == "" {
+			return fmt.Errorf("invalid scope %q, expected resource:operation", scope)
+		}
+	}
+	return nil
+}
+
+// APIKeyForm issues a key.
+type APIKeyForm struct {
+	Name      string     `json:"name" validate:"required"`
+	Scopes    []string   `json:"scopes" validate:"required,min=1"`
+	Subject   string     `json:"subject"`
+	Roles     []string   `json:"roles"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// Register adds the admin endpoints below /apikeys of mux:
+//
+//	POST   /apikeys             issue a key, answered with its value
+//	GET    /apikeys             list the keys
+//	GET    /apikeys/:id         view a key
+//	DELETE /apikeys/:id         revoke a key
+//	POST   /apikeys/:id/rotate  issue a replacement, ?overlap=1h sets how long the old key keeps working
+//
+// The endpoints run through the stage pipeline of an APIService named
+// "apikey", which is returned so that interceptors can be added. They are
+// guarded by security, or when it is empty by the Security of the
+// ResourceConfig of the returned service; requests are refused when neither
+// is set. Requests authenticated with an API key can only issue and rotate
+// keys whose scopes and roles their own key covers, answered with 403
+// otherwise.
+func (k *APIKeys) Register(mux Mux, security Security, validator echo.Validator) *APIService {
+	service := NewAPIServiceWithMux("apikey", mux.Group("/apikeys"), validator, k.Logger)
+
+	handle := func(method, path string, operation Operation, respond func(s *State) error) {
+		service.Mux.Handle(method, path, func(c Context) error {
+			state := &State{Operation: operation, Service: service, Context: c, Security: service.securityFor(operation, security), ID: c.Param("id")}
+			return service.run(state, []Stage{
+				adminAuthenticateStage(),
+				authorizeStage(),
+				{Name: StageRespond, Run: respond},
+			}, nil)
+		})
+	}
+
+	handle(http.MethodPost, "", OperationCreate, func(s *State) error {
+		form := new(APIKeyForm)
+		if err := s.Context.Bind(form); err != nil {
+			return NewStageError(http.StatusBadRequest, err, "failed to bind form")
+		}
+		if err := s.Context.Validate(form); err != nil {
+			return NewStageError(http.StatusBadRequest, err, "failed to bind form")
+		}
+
+		issued := APIKey{Name: form.Name, Scopes: form.Scopes, Subject: form.Subject, Roles: form.Roles, ExpiresAt: form.ExpiresAt}
+		if err := checkDelegation(GetAPIKey(s.Context), &issued); err != nil {
+			return NewStageError(http.StatusForbidden, err, "authorization failed")
+		}
+
+		key, raw, err := k.Issue(issued)
+		if err != nil {
+			return NewStageError(http.StatusBadRequest, err, "cannot issue api key")
+		}
+		return SuccessResponse(s.Context, http.StatusOK, "successfully issued api key", echo.Map{"apikey": key, "key": raw}, MetaData{})
+	})
+
+	handle(http.MethodGet, "", OperationList, func(s *State) error {
+		keys, err := k.Store.ListKeys()
+		if err != nil {
+			return NewStageError(http.StatusInternalServerError, err, "cannot find any api key")
+		}
+		return SuccessResponse(s.Context, http.StatusOK, "successfully loaded api key list", echo.Map{"apikeys": keys}, MetaData{TotalCounts: len(keys)})
+	})
+
+	handle(http.MethodGet, "/:id", OperationView, func(s *State) error {
+		key, err := k.Store.GetKey(s.ID)
+		if err != nil {
+			return apiKeyLookupError(err)
+		}
+		return SuccessResponse(s.Context, http.StatusOK, "successfully loaded api key", echo.Map{"apikey": key}, MetaData{})
+	})
+
+	handle(http.MethodDelete, "/:id", OperationDelete, func(s *State) error {
+		if err := k.Revoke(s.ID); err != nil {
+			return apiKeyLookupError(err)
+		}
+		return SuccessResponse(s.Context, http.StatusOK, "successfully revoked", nil, MetaData{})
+	})
+
+	handle(http.MethodPost, "/:id/rotate", Operation("rotate"), func(s *State) error {
+		var overlap time.Duration
+		if value := s.Context.QueryParam("overlap"); value != "" {
+			var err error
+			if overlap, err = time.ParseDuration(value); err != nil {
+				return NewStageError(http.StatusBadRequest, err, "invalid overlap")
+			}
+		}
+
+		old, err := k.Store.GetKey(s.ID)
+		if err != nil {
+			return apiKeyLookupError(err)
+		}
+		if err := checkDelegation(GetAPIKey(s.Context), old); err != nil {
+			return NewStageError(http.StatusForbidden, err, "authorization failed")
+		}
+
+		key, raw, err := k.Rotate(s.ID, overlap)
+		if err != nil {
+			if errors.Is(err, ErrAPIKeyNotFound) {
+				return apiKeyLookupError(err)
+			}
+			return NewStageError(http.StatusBadRequest, err, "cannot rotate api key")
+		}
+		return SuccessResponse(s.Context, http.StatusOK, "successfully rotated api key", echo.Map{"apikey": key, "key": raw}, MetaData{})
+	})
+
+	return service
+}
+
+func apiKeyLookupError(err error) error {
+	if errors.Is(err, ErrAPIKeyNotFound) {
+		return NewStageError(http.StatusNotFound, err, "api key not found")
+	}
+	return NewStageError(http.StatusInternalServerError, err, "cannot load api key")
+}
@@ -0,0 +1,118 @@
+package apimaker
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestAPIKeyScopes(t *testing.T) {
+	keys := NewAPIKeys(NewMemoryAPIKeyStore())
+	mux, _ := newTestResources(t, `
+resources:
+  - name: item
+    fields:
+      - {name: title, type: string}
+    security: {authenticate: true}
+`, DefinitionOptions{Authenticator: keys.Authenticator()})
+
+	_, writer, err := keys.Issue(APIKey{Name: "writer", Scopes: []string{"item:*"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, reader, err := keys.Issue(APIKey{Name: "reader", Scopes: []string{"item:view"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if w := serve(mux, http.MethodPost, "/item/create", `{"title":"a"}`, http.Header{"X-Api-Key": {writer}}); w.Code != http.StatusOK {
+		t.Fatalf("create with item:* = %d %s", w.Code, w.Body)
+	}
+
+	tests := []struct {
+		method, path, key string
+		code              int
+	}{
+		{http.MethodGet, "/item/view/1", reader, http.StatusOK},
+		{http.MethodDelete, "/item/delete/1", reader, http.StatusForbidden},
+		{http.MethodGet, "/item/list", reader, http.StatusForbidden},
+		{http.MethodGet, "/item/view/1", "ak_unknown", http.StatusUnauthorized},
+		{http.MethodGet, "/item/view/1", "", http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		if w := serve(mux, test.method, test.path, "", http.Header{"X-Api-Key": {test.key}}); w.Code != test.code {
+			t.Errorf("%s %s = %d, want %d: %s", test.method, test.path, w.Code, test.code, w.Body)
+		}
+	}
+}
+
+func TestAPIKeyRevokeAndRotate(t *testing.T) {
+	keys := NewAPIKeys(NewMemoryAPIKeyStore())
+	mux, _ := newTestResources(t, `
+resources:
+  - name: item
+    fields:
+      - {name: title, type: string}
+    security: {authenticate: true}
+`, DefinitionOptions{Authenticator: keys.Authenticator()})
+
+	key, raw, err := keys.Issue(APIKey{Name: "app", Scopes: []string{"*:*"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.Hash != HashAPIKey(raw) || key.Hash == raw {
+		t.Fatal("the key is not stored hashed")
+	}
+
+	rotated, rotatedRaw, err := keys.Rotate(key.ID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, value := range []string{raw, rotatedRaw} {
+		if w := serve(mux, http.MethodGet, "/item/list", "", http.Header{"X-Api-Key": {value}}); w.Code != http.StatusOK {
+			t.Errorf("list during the rotation overlap = %d", w.Code)
+		}
+	}
+
+	if err := keys.Revoke(rotated.ID); err != nil {
+		t.Fatal(err)
+	}
+	if w := serve(mux, http.MethodGet, "/item/list", "", http.Header{"X-Api-Key": {rotatedRaw}}); w.Code != http.StatusUnauthorized {
+		t.Errorf("list with a revoked key = %d", w.Code)
+	}
+}
+
+func TestAPIKeyCannotIssueBroaderKeys(t *testing.T) {
+	keys := NewAPIKeys(NewMemoryAPIKeyStore())
+	mux := http.NewServeMux()
+	keys.Register(HTTPMux(mux, "", testValidator{}), Security{Authenticator: keys.Authenticator()}, testValidator{})
+
+	_, admin, err := keys.Issue(APIKey{Name: "admin", Scopes: []string{"apikey:*", "item:*"}, Roles: []string{"editor"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	broad, _, err := keys.Issue(APIKey{Name: "root", Scopes: []string{"*:*"}, Roles: []string{"admin"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header := http.Header{"X-Api-Key": {admin}}
+	tests := []struct {
+		body string
+		code int
+	}{
+		{`{"name":"k","scopes":["item:view"],"roles":["editor"]}`, http.StatusOK},
+		{`{"name":"k","scopes":["*:*"]}`, http.StatusForbidden},
+		{`{"name":"k","scopes":["*:view"]}`, http.StatusForbidden},
+		{`{"name":"k","scopes":["item:view"],"roles":["admin"]}`, http.StatusForbidden},
+		{`{"name":"k","scopes":["item:view"],"subject":"someone"}`, http.StatusForbidden},
+	}
+	for _, test := range tests {
+		if w := serve(mux, http.MethodPost, "/apikeys", test.body, header); w.Code != test.code {
+			t.Errorf("issue %s = %d, want %d: %s", test.body, w.Code, test.code, w.Body)
+		}
+	}
+
+	if w := serve(mux, http.MethodPost, "/apikeys/"+broad.ID+"/rotate", "", header); w.Code != http.StatusForbidden {
+		t.Errorf("rotate of a broader key = %d, want 403: %s", w.Code, w.Body)
+	}
+}
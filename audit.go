@@ -0,0 +1,402 @@
+package apimaker
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// OperationAudit is the operation of the audit endpoint.
+const OperationAudit Operation = "audit"
+
+// AuditRecord describes who performed an operation on a record, and when.
+type AuditRecord struct {
+	ID          string        `json:"id"`
+	Time        time.Time     `json:"time"`
+	PrincipalID string        `json:"principal_id,omitempty"`
+	Roles       []string      `json:"roles,omitempty"`
+	Operation   Operation     `json:"operation"`
+	Resource    string        `json:"resource"`
+	RecordID    string        `json:"record_id,omitempty"`
+	ClientIP    string        `json:"client_ip,omitempty"`
+	RequestID   string        `json:"request_id,omitempty"`
+	Changes     []FieldChange `json:"changes,omitempty"`
+}
+
+// FieldChange is the change of one JSON field of a model. Old is absent for
+// created records and New for deleted ones.
+type FieldChange struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old,omitempty"`
+	New   interface{} `json:"new,omitempty"`
+}
+
+// DiffValues compares the top-level fields of two JSON objects, such as the
+// snapshots returned by toJSONValue, and returns the changed ones sorted by name.
+func DiffValues(before, after interface{}) []FieldChange {
+	oldValues, _ := before.(map[string]interface{})
+	newValues, _ := after.(map[string]interface{})
+
+	names := map[string]bool{}
+	for name := range oldValues {
+		names[name] = true
+	}
+	for name := range newValues {
+		names[name] = true
+	}
+
+	var changes []FieldChange
+	for name := range names {
+		if !reflect.DeepEqual(oldValues[name], newValues[name]) {
+			changes = append(changes, FieldChange{Field: name, Old: oldValues[name], New: newValues[name]})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes
+}
+
+// AuditSink stores audit records.
+type AuditSink interface {
+	Write(record AuditRecord) error
+}
+
+// AuditQuery selects audit records; zero fields match everything. Records
+// are returned newest first.
+type AuditQuery struct {
+	Resource    string
+	RecordID    string
+	PrincipalID string
+	Operation   Operation
+	Since       time.Time
+	Until       time.Time
+	Limit       int
+	Page        int
+}
+
+func (q AuditQuery) matches(record AuditRecord) bool {
+	return (q.Resource == "" || record.Resource == q.Resource) &&
+		(q.RecordID == "" || record.RecordID == q.RecordID) &&
+		(q.PrincipalID == "" || record.PrincipalID == q.PrincipalID) &&
+		(q.Operation == "" || record.Operation == q.Operation) &&
+		(q.Since.IsZero() || !record.Time.Before(q.Since)) &&
+		(q.Until.IsZero() || record.Time.Before(q.Until))
+}
+
+// page sorts the matching records newest first and returns the requested
+// page with the total count.
+func (q AuditQuery) page(records []AuditRecord) (int, []AuditRecord) {
+	sort.SliceStable(records, func(i, j int) bool { return records[i].Time.After(records[j].Time) })
+
+	total := len(records)
+	if q.Limit < 1 {
+		return total, records
+	}
+
+	page := q.Page
+	if page < 1 {
+		page = 1
+	}
+	start := (page - 1) * q.Limit
+	if start > total {
+		start = total
+	}
+	end := start + q.Limit
+	if end > total {
+		end = total
+	}
+	return total, records[start:end]
+}
+
+// AuditQuerier is implemented by sinks that can be read by the audit endpoint.
+type AuditQuerier interface {
+	Query(q AuditQuery) (int, []AuditRecord, error)
+}
+
+// MemoryAuditSink keeps audit records in memory.
+type MemoryAuditSink struct {
+	mu      sync.RWMutex
+	records []AuditRecord
+}
+
+// NewMemoryAuditSink creates an empty MemoryAuditSink.
+func NewMemoryAuditSink() *MemoryAuditSink {
+	return &MemoryAuditSink{}
+}
+
+func (s *MemoryAuditSink) Write(record AuditRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, record)
+	return nil
+}
+
+func (s *MemoryAuditSink) Query(q AuditQuery) (int, []AuditRecord, error) {
+	s.mu.RLock()
+	records := []AuditRecord{}
+	for _, record := range s.records {
+		if q.matches(record) {
+			records = append(records, record)
+		}
+	}
+	s.mu.RUnlock()
+
+	total, records := q.page(records)
+	return total, records, nil
+}
+
+// JSONLinesAuditSink appends audit records to a file, one JSON object per line.
+type JSONLinesAuditSink struct {
+	mu   sync.Mutex
+	path string
+	file *os.File
+}
+
+// NewJSONLinesAuditSink opens, or creates, the file at path for appending.
+func NewJSONLinesAuditSink(path string) (*JSONLinesAuditSink, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONLinesAuditSink{path: path, file: file}, nil
+}
+
+func (s *JSONLinesAuditSink) Write(record AuditRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.file.Write(append(line, '\n'))
+	return err
+}
+
+// Query scans the file for the matching records.
+func (s *JSONLinesAuditSink) Query(q AuditQuery) (int, []AuditRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := os.Open(s.path)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer file.Close()
+
+	records := []AuditRecord{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var record AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return 0, nil, fmt.Errorf("invalid audit record: %w", err)
+		}
+		if q.matches(record) {
+			records = append(records, record)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, nil, err
+	}
+
+	total, records := q.page(records)
+	return total, records, nil
+}
+
+// Close closes the file.
+func (s *JSONLinesAuditSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// Auditor is an Interceptor writing an audit record for every successful
+// Create, Edit and Delete, and View when Views is set, of the services using
+// it. The record is written once the change is saved; when the sink fails the
+// request answers 500 although the change has been made.
+type Auditor struct {
+	Sink  AuditSink
+	Views bool
+	// Redact lists JSON fields whose values are replaced in the changes.
+	Redact []string
+	// RequestID returns the id of the request, by default the X-Request-Id header.
+	RequestID func(c Context) string
+}
+
+// NewAuditor creates an Auditor writing to sink.
+func NewAuditor(sink AuditSink) *Auditor {
+	return &Auditor{Sink: sink}
+}
+
+// Intercept snapshots the record after the fetch stage and writes the audit
+// record after the publish stage.
+func (a *Auditor) Intercept(s *State, stage string, next func() error) error {
+	if !a.audits(s.Operation) {
+		return next()
+	}
+
+	if err := next(); err != nil {
+		return err
+	}
+
+	switch stage {
+	case StageFetch:
+		if s.Before != nil || (s.Operation != OperationEdit && s.Operation != OperationDelete) {
+			return nil
+		}
+		// the delete operation only loads the model when it is needed
+		if err := s.fetch(); err != nil {
+			return nil
+		}
+
+		before, err := toJSONValue(s.Model)
+		if err != nil {
+			return NewStageError(http.StatusInternalServerError, err, fmt.Sprintf("cannot encode %s", s.Service.Name))
+		}
+		s.Before = before
+	case StagePublish:
+		record, err := a.record(s)
+		if err != nil {
+			return NewStageError(http.StatusInternalServerError, err, fmt.Sprintf("cannot encode %s", s.Service.Name))
+		}
+		if err := a.Sink.Write(record); err != nil {
+			return NewStageError(http.StatusInternalServerError, err, "cannot write audit record")
+		}
+	}
+	return nil
+}
+
+func (a *Auditor) audits(operation Operation) bool {
+	switch operation {
+	case OperationCreate, OperationEdit, OperationDelete:
+		return true
+	case OperationView:
+		return a.Views
+	}
+	return false
+}
+
+// record describes the operation of the state.
+func (a *Auditor) record(s *State) (AuditRecord, error) {
+	record := AuditRecord{
+		ID:        newEventID(),
+		Time:      time.Now().UTC(),
+		Operation: s.Operation,
+		Resource:  s.Service.Name,
+		RecordID:  s.ID,
+		ClientIP:  ClientIP(s.Context.Request()),
+	}
+
+	if principal := GetPrincipal(s.Context); principal != nil {
+		record.PrincipalID, record.Roles = principal.ID, principal.Roles
+	}
+
+	if a.RequestID != nil {
+		record.RequestID = a.RequestID(s.Context)
+	} else {
+		record.RequestID = s.Context.Request().Header.Get(echo.HeaderXRequestID)
+	}
+
+	var after interface{}
+	if s.Operation != OperationDelete {
+		var err error
+		if after, err = toJSONValue(s.Model); err != nil {
+			return record, err
+		}
+		if values, ok := after.(map[string]interface{}); ok && record.RecordID == "" && values["id"] != nil {
+			record.RecordID = fmt.Sprint(values["id"])
+		}
+	}
+
+	if s.Operation != OperationView {
+		record.Changes = DiffValues(s.Before, after)
+		for i, change := range record.Changes {
+			for _, field := range a.Redact {
+				if change.Field == field {
+					record.Changes[i] = FieldChange{Field: field, Old: redacted(change.Old), New: redacted(change.New)}
+				}
+			}
+		}
+	}
+	return record, nil
+}
+
+func redacted(value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	return "[redacted]"
+}
+
+// Register adds GET /audit to the routes of service, listing the audit records
+// of the resource newest first. It accepts the record_id, principal_id,
+// operation, since and until (RFC 3339) filters and limit and page. The sink
+// must implement AuditQuerier. The endpoint is guarded by security, or when it
+// is empty by the Security the ResourceConfig of the service gives
+// OperationAudit; requests are refused when neither is set.
+func (a *Auditor) Register(service *APIService, security Security) error {
+	querier, ok := a.Sink.(AuditQuerier)
+	if !ok {
+		return fmt.Errorf("audit sink %T cannot be queried", a.Sink)
+	}
+
+	service.mux().Handle(http.MethodGet, "/audit", func(c Context) error {
+		state := &State{Operation: OperationAudit, Service: service, Context: c, Security: service.securityFor(OperationAudit, security)}
+		return service.run(state, []Stage{
+			adminAuthenticateStage(),
+			authorizeStage(),
+			{Name: StagePaginate, Run: func(s *State) error {
+				pagination, err := SetPagination(s.Context)
+				if err != nil {
+					return NewStageError(http.StatusBadRequest, err, "invalid pagination")
+				}
+				s.Pagination = pagination
+				return nil
+			}},
+			{Name: StageRespond, Run: func(s *State) error {
+				q := AuditQuery{
+					Resource:    service.Name,
+					RecordID:    c.QueryParam("record_id"),
+					PrincipalID: c.QueryParam("principal_id"),
+					Operation:   Operation(c.QueryParam("operation")),
+					Limit:       s.Pagination.Limit,
+					Page:        s.Pagination.Page,
+				}
+				for name, at := range map[string]*time.Time{"since": &q.Since, "until": &q.Until} {
+					if value := c.QueryParam(name); value != "" {
+						parsed, err := time.Parse(time.RFC3339, value)
+						if err != nil {
+							return NewStageError(http.StatusBadRequest, err, fmt.Sprintf("invalid %s", name))
+						}
+						*at = parsed
+					}
+				}
+
+				total, records, err := querier.Query(q)
+				if err != nil {
+					return NewStageError(http.StatusInternalServerError, err, "cannot load audit records")
+				}
+
+				totalPages := 1
+				if q.Limit > 0 {
+					totalPages = (total + q.Limit - 1) / q.Limit
+				}
+				return SuccessResponse(s.Context, http.StatusOK, "successfully loaded audit records", echo.Map{"audit": records}, MetaData{
+					Limit:       q.Limit,
+					TotalCounts: total,
+					TotalPages:  totalPages,
+					CurrentPage: q.Page,
+				})
+			}},
+		}, nil)
+	})
+	return nil
+}
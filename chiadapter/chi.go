@@ -0,0 +1,47 @@
+// Package chiadapter registers api_maker services on a chi router. It is a
+// module of its own so that api_maker itself does not depend on chi.
+package chiadapter
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/labstack/echo/v4"
+	apimaker "github.com/yasinsaee/api_maker"
+)
+
+// mux registers routes below prefix on a chi router.
+type mux struct {
+	router    chi.Router
+	prefix    string
+	validator echo.Validator
+}
+
+// Mux adapts a chi router. Routes are registered below prefix and requests
+// are validated with validator.
+func Mux(router chi.Router, prefix string, validator echo.Validator) apimaker.Mux {
+	return mux{router: router, prefix: strings.TrimSuffix(prefix, "/"), validator: validator}
+}
+
+// NewAPIService creates an APIService registering its routes below prefix on router.
+func NewAPIService(name string, router chi.Router, prefix string, validator echo.Validator, logger echo.Logger) *apimaker.APIService {
+	return apimaker.NewAPIServiceWithMux(name, Mux(router, prefix, validator), validator, logger)
+}
+
+func (m mux) Handle(method, path string, h apimaker.HandlerFunc) string {
+	full := m.prefix + path
+	pattern, names := apimaker.PathPattern(full)
+	m.router.MethodFunc(method, pattern, func(w http.ResponseWriter, r *http.Request) {
+		params := make(map[string]string, len(names))
+		for _, name := range names {
+			params[name] = chi.URLParam(r, name)
+		}
+		apimaker.ServeHTTPContext(apimaker.NewHTTPContext(w, r, params, m.validator), h)
+	})
+	return full
+}
+
+func (m mux) Group(prefix string) apimaker.Mux {
+	return mux{router: m.router, prefix: m.prefix + prefix, validator: m.validator}
+}
@@ -0,0 +1,99 @@
+package apimaker
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+)
+
+// trustedProxies holds the networks of the proxies set with TrustProxies.
+var trustedProxies struct {
+	mu       sync.RWMutex
+	networks []*net.IPNet
+}
+
+// TrustProxies sets the addresses or CIDR networks of the reverse proxies in
+// front of the application, replacing those set before. ClientIP only reads
+// the X-Forwarded-For and X-Real-Ip headers of requests coming from them.
+func TrustProxies(proxies ...string) error {
+	var networks []*net.IPNet
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return fmt.Errorf("invalid proxy address %q", proxy)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return fmt.Errorf("invalid proxy network %q: %w", proxy, err)
+		}
+		networks = append(networks, network)
+	}
+
+	trustedProxies.mu.Lock()
+	defer trustedProxies.mu.Unlock()
+	trustedProxies.networks = networks
+	return nil
+}
+
+// trustedProxy reports whether addr is the address of a trusted proxy.
+func trustedProxy(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+
+	trustedProxies.mu.RLock()
+	defer trustedProxies.mu.RUnlock()
+	for _, network := range trustedProxies.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the address of the client of r, the remote address of the
+// connection unless it is a proxy trusted with TrustProxies. Requests of
+// trusted proxies are attributed to the last address of X-Forwarded-For not
+// added by a trusted proxy, or to X-Real-Ip.
+func ClientIP(r *http.Request) string {
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		ip = host
+	}
+	if !trustedProxy(ip) {
+		return ip
+	}
+
+	if forwarded := r.Header.Values(echo.HeaderXForwardedFor); len(forwarded) > 0 {
+		addrs := strings.Split(strings.Join(forwarded, ","), ",")
+		for i := len(addrs) - 1; i >= 0; i-- {
+			addr := strings.TrimSpace(addrs[i])
+			if addr == "" {
+				continue
+			}
+			ip = addr
+			if !trustedProxy(addr) {
+				break
+			}
+		}
+		return ip
+	}
+	if realIP := strings.TrimSpace(r.Header.Get(echo.HeaderXRealIP)); realIP != "" {
+		return realIP
+	}
+	return ip
+}
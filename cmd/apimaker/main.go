@@ -0,0 +1,66 @@
+// Command apimaker scaffolds api_maker resources.
+//
+// Usage:
+//
+//	apimaker new resource <name> --fields name:string:required,price:float:gt=0 [--store memory|sql|none] [--dir path] [--force]
+//
+// Every field is written as name:type[:rules]. Types are string, int, int64,
+// float, bool and time; rules are validator tags joined with "+", for example
+// name:string:required+min=2.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+func main() {
+	if err := run(os.Args[1:]); err != nil {
+		fmt.Fprintln(os.Stderr, "apimaker:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string) error {
+	if len(args) < 3 || args[0] != "new" || args[1] != "resource" {
+		return fmt.Errorf("usage: apimaker new resource <name> --fields name:type[:rules],... [--store memory|sql|none] [--dir path] [--force]")
+	}
+
+	name := args[2]
+	flags := flag.NewFlagSet("new resource", flag.ContinueOnError)
+	fields := flags.String("fields", "", "comma separated fields as name:type[:rules]")
+	store := flags.String("store", "memory", "storage backend stub: memory, sql or none")
+	dir := flags.String("dir", "", "directory the package is written to, ./<name> by default")
+	force := flags.Bool("force", false, "overwrite existing files")
+	if err := flags.Parse(args[3:]); err != nil {
+		return err
+	}
+
+	resource, err := parseResource(name, *fields, *store)
+	if err != nil {
+		return err
+	}
+
+	if *dir == "" {
+		*dir = resource.Package
+	}
+
+	written, err := scaffold(resource, *dir, *force)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range written {
+		fmt.Println("created", path)
+	}
+	fmt.Printf(`
+Register the resource in your main package, on any router apimaker supports:
+
+	apiService := apimaker.NewAPIService(%q, ec.Group("/%s"), ec.Validator, ec.Logger)
+	if err := %s.Register(apiService); err != nil {
+		log.Fatal(err)
+	}
+`, resource.Name, resource.Name, resource.Package)
+	return nil
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"go/format"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+//go:embed templates/*.tmpl
+var templates embed.FS
+
+// resource is the data the templates are rendered with.
+type resource struct {
+	Name    string
+	Package string
+	Type    string
+	Table   string
+	Store   string
+	Date    string
+	Fields  []field
+}
+
+// field is a single model field.
+type field struct {
+	JSON     string
+	GoName   string
+	GoType   string
+	Validate string
+}
+
+// UsesTime reports whether any field is a time.Time.
+func (r resource) UsesTime() bool {
+	for _, f := range r.Fields {
+		if f.GoType == "time.Time" {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	identPattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+	goTypes      = map[string]string{
+		"string": "string",
+		"int":    "int",
+		"int64":  "int64",
+		"float":  "float64",
+		"bool":   "bool",
+		"time":   "time.Time",
+	}
+	stores = map[string]bool{"memory": true, "sql": true, "none": true}
+)
+
+// parseResource validates the command line input.
+func parseResource(name, fields, store string) (resource, error) {
+	if !identPattern.MatchString(name) {
+		return resource{}, fmt.Errorf("invalid resource name %q: use lower case letters, digits and underscores", name)
+	}
+
+	if !stores[store] {
+		return resource{}, fmt.Errorf("unknown store %q: use memory, sql or none", store)
+	}
+
+	r := resource{
+		Name:    name,
+		Package: strings.ReplaceAll(name, "_", ""),
+		Type:    exportName(name),
+		Table:   name + "s",
+		Store:   store,
+		Date:    time.Now().Format("2006-01-02"),
+	}
+
+	if fields == "" {
+		return resource{}, errors.New("at least one field is required, e.g. --fields name:string:required")
+	}
+
+	seen := map[string]bool{"id": true}
+	for _, spec := range strings.Split(fields, ",") {
+		parts := strings.SplitN(strings.TrimSpace(spec), ":", 3)
+		if len(parts) < 2 {
+			return resource{}, fmt.Errorf("invalid field %q: use name:type[:rules]", spec)
+		}
+
+		if !identPattern.MatchString(parts[0]) {
+			return resource{}, fmt.Errorf("invalid field name %q", parts[0])
+		}
+
+		if seen[parts[0]] {
+			return resource{}, fmt.Errorf("duplicate field %q", parts[0])
+		}
+		seen[parts[0]] = true
+
+		goType, ok := goTypes[parts[1]]
+		if !ok {
+			return resource{}, fmt.Errorf("unknown type %q of field %q: use string, int, int64, float, bool or time", parts[1], parts[0])
+		}
+
+		f := field{JSON: parts[0], GoName: exportName(parts[0]), GoType: goType}
+		if len(parts) == 3 {
+			f.Validate = strings.ReplaceAll(parts[2], "+", ",")
+		}
+		r.Fields = append(r.Fields, f)
+	}
+	return r, nil
+}
+
+// scaffold renders the resource package into dir and returns the written paths.
+func scaffold(r resource, dir string, force bool) ([]string, error) {
+	files := map[string]string{
+		r.Name + ".go": "model_" + r.Store + ".go.tmpl",
+		"form.go":      "form.go.tmpl",
+		"filter.go":    "filter.go.tmpl",
+		"register.go":  "register.go.tmpl",
+	}
+
+	funcs := template.FuncMap{"inc": func(i int) int { return i + 1 }}
+	tmpl, err := template.New("").Funcs(funcs).ParseFS(templates, "templates/*.tmpl")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	var written []string
+	for _, name := range []string{r.Name + ".go", "form.go", "filter.go", "register.go"} {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil && !force {
+			return written, fmt.Errorf("%s already exists, use --force to overwrite", path)
+		}
+
+		var src bytes.Buffer
+		if err := tmpl.ExecuteTemplate(&src, files[name], r); err != nil {
+			return written, err
+		}
+
+		formatted, err := format.Source(src.Bytes())
+		if err != nil {
+			return written, fmt.Errorf("cannot format %s: %w", name, err)
+		}
+
+		if err := os.WriteFile(path, formatted, 0o644); err != nil {
+			return written, err
+		}
+		written = append(written, path)
+	}
+	return written, nil
+}
+
+// exportName turns "product_item" into "ProductItem".
+func exportName(name string) string {
+	var b strings.Builder
+	for _, part := range strings.Split(name, "_") {
+		if part == "" {
+			continue
+		}
+		if part == "id" {
+			b.WriteString("ID")
+			continue
+		}
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
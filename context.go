@@ -0,0 +1,149 @@
+package apimaker
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Context is the request/response abstraction the Create, Edit, View, List
+// and Delete pipelines depend on. echo.Context satisfies it as is; HTTPContext
+// provides it for net/http and the routers built on top of it.
+type Context interface {
+	Request() *http.Request
+	Param(name string) string
+	QueryParam(name string) string
+	Bind(i interface{}) error
+	Validate(i interface{}) error
+	Get(key string) interface{}
+	Set(key string, val interface{})
+	JSON(code int, i interface{}) error
+}
+
+// HandlerFunc handles a request of any router.
+type HandlerFunc func(c Context) error
+
+// HTTPContext implements Context on top of net/http. Request binding follows
+// echo's rules, so forms and filters behave the same on every router.
+type HTTPContext struct {
+	request   *http.Request
+	response  http.ResponseWriter
+	params    map[string]string
+	query     url.Values
+	validator echo.Validator
+	store     map[string]interface{}
+	committed bool
+}
+
+// bindEcho only provides the contexts echo's binder works on.
+var bindEcho = echo.New()
+
+// NewHTTPContext creates a Context for a request whose route parameters have
+// already been extracted by the router.
+func NewHTTPContext(w http.ResponseWriter, r *http.Request, params map[string]string, validator echo.Validator) *HTTPContext {
+	return &HTTPContext{
+		request:   r,
+		response:  w,
+		params:    params,
+		validator: validator,
+		store:     map[string]interface{}{},
+	}
+}
+
+// Request returns the underlying request.
+func (c *HTTPContext) Request() *http.Request {
+	return c.request
+}
+
+// Param returns a route parameter.
+func (c *HTTPContext) Param(name string) string {
+	return c.params[name]
+}
+
+// QueryParam returns a query string parameter.
+func (c *HTTPContext) QueryParam(name string) string {
+	if c.query == nil {
+		c.query = c.request.URL.Query()
+	}
+	return c.query.Get(name)
+}
+
+// Bind binds the query string of GET, HEAD and DELETE requests and then the
+// body into i, like echo.DefaultBinder. Route parameters are read with Param.
+func (c *HTTPContext) Bind(i interface{}) error {
+	binder := &echo.DefaultBinder{}
+	ec := bindEcho.NewContext(c.request, c.response)
+
+	method := c.request.Method
+	if method == http.MethodGet || method == http.MethodHead || method == http.MethodDelete {
+		if err := binder.BindQueryParams(ec, i); err != nil {
+			return err
+		}
+	}
+	return binder.BindBody(ec, i)
+}
+
+// Validate validates i with the validator of the adapter.
+func (c *HTTPContext) Validate(i interface{}) error {
+	if c.validator == nil {
+		return echo.ErrValidatorNotRegistered
+	}
+	return c.validator.Validate(i)
+}
+
+// Get returns a value stored for the request.
+func (c *HTTPContext) Get(key string) interface{} {
+	return c.store[key]
+}
+
+// Set stores a value for the request.
+func (c *HTTPContext) Set(key string, val interface{}) {
+	c.store[key] = val
+}
+
+// JSON writes i as the JSON response body.
+func (c *HTTPContext) JSON(code int, i interface{}) error {
+	c.response.Header().Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	c.response.WriteHeader(code)
+	c.committed = true
+	return json.NewEncoder(c.response).Encode(i)
+}
+
+// Committed reports whether the response has been written.
+func (c *HTTPContext) Committed() bool {
+	return c.committed
+}
+
+// responseWriter returns the writer of the response, for handlers streaming
+// their response; the response counts as committed from then on.
+func responseWriter(c Context) (http.ResponseWriter, bool) {
+	switch c := c.(type) {
+	case interface{ Response() *echo.Response }:
+		return c.Response(), true
+	case *HTTPContext:
+		c.committed = true
+		return c.response, true
+	}
+	return nil, false
+}
+
+// responseHeader returns the header of the response of c, to be set before
+// the response is written, or nil when c does not expose it.
+func responseHeader(c Context) http.Header {
+	switch c := c.(type) {
+	case interface{ Response() *echo.Response }:
+		return c.Response().Header()
+	case *HTTPContext:
+		return c.response.Header()
+	}
+	return nil
+}
+
+// ServeHTTPContext runs h and answers 500 when it fails before writing a response.
+func ServeHTTPContext(c *HTTPContext, h HandlerFunc) {
+	if err := h(c); err != nil && !c.committed {
+		http.Error(c.response, err.Error(), http.StatusInternalServerError)
+	}
+}
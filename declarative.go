@@ -0,0 +1,590 @@
+package apimaker
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"gopkg.in/yaml.v3"
+)
+
+// Definitions describes resources declaratively, so that simple tables get
+// CRUD endpoints without any Go code. A YAML definition looks like:
+//
+//	resources:
+//	  - name: country
+//	    fields:
+//	      - {name: code, type: string, validate: "required,len=2", filterable: true}
+//	      - {name: name, type: string, validate: required, sortable: true}
+//	      - {name: population, type: int, validate: "gte=0", sortable: true}
+//	    security:
+//	      authenticate: true
+//	      write_roles: [admin]
+//	    routes: [view, list, create]
+type Definitions struct {
+	Resources []ResourceDefinition `json:"resources" yaml:"resources"`
+}
+
+// ResourceDefinition describes one resource. Path defaults to "/" + Name and
+// Routes to every operation.
+type ResourceDefinition struct {
+	Name     string             `json:"name" yaml:"name"`
+	Path     string             `json:"path,omitempty" yaml:"path,omitempty"`
+	Fields   []FieldDefinition  `json:"fields" yaml:"fields"`
+	Security SecurityDefinition `json:"security,omitempty" yaml:"security,omitempty"`
+	Routes   []Operation        `json:"routes,omitempty" yaml:"routes,omitempty"`
+}
+
+// FieldDefinition describes a field of a resource. Type is one of string, int,
+// float, bool and time; Validate holds validator tags such as "required,max=20".
+// Filterable fields can be matched exactly in list queries and sortable ones
+// used in the sort parameter.
+type FieldDefinition struct {
+	Name       string `json:"name" yaml:"name"`
+	Type       string `json:"type" yaml:"type"`
+	Validate   string `json:"validate,omitempty" yaml:"validate,omitempty"`
+	Filterable bool   `json:"filterable,omitempty" yaml:"filterable,omitempty"`
+	Sortable   bool   `json:"sortable,omitempty" yaml:"sortable,omitempty"`
+}
+
+// SecurityDefinition describes who may call a resource. Roles are required to
+// view and list records, WriteRoles to create, edit and delete them and
+// default to Roles. Roles are checked against the Principal of the request,
+// so they need an authenticator that sets one.
+type SecurityDefinition struct {
+	Authenticate bool     `json:"authenticate,omitempty" yaml:"authenticate,omitempty"`
+	Roles        []string `json:"roles,omitempty" yaml:"roles,omitempty"`
+	WriteRoles   []string `json:"write_roles,omitempty" yaml:"write_roles,omitempty"`
+}
+
+// DefinitionOptions configures the services registered from Definitions.
+type DefinitionOptions struct {
+	// Authenticator is used by resources requiring authentication or roles.
+	Authenticator func(c Context) (bool, error)
+	Validator     echo.Validator
+	Logger        echo.Logger
+	// Outbox, when set, receives the created, updated and deleted events of
+	// the resources in the transactions of their changes; see UseOutbox.
+	Outbox *MemoryOutbox
+}
+
+var (
+	definitionNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+	definitionTypes       = map[string]reflect.Type{
+		"string": reflect.TypeOf(""),
+		"int":    reflect.TypeOf(int64(0)),
+		"float":  reflect.TypeOf(float64(0)),
+		"bool":   reflect.TypeOf(false),
+		"time":   timeType,
+	}
+	allOperations = []Operation{OperationCreate, OperationEdit, OperationView, OperationList, OperationDelete}
+)
+
+// LoadDefinitions reads and validates a .yaml, .yml or .json definition file.
+func LoadDefinitions(path string) (*Definitions, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	format := strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	defs, err := ParseDefinitions(data, format)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return defs, nil
+}
+
+// ParseDefinitions decodes and validates definitions in the given format,
+// "yaml", "yml" or "json". Unknown keys are rejected.
+func ParseDefinitions(data []byte, format string) (*Definitions, error) {
+	defs := new(Definitions)
+	switch format {
+	case "yaml", "yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(defs); err != nil {
+			return nil, fmt.Errorf("invalid yaml: %w", err)
+		}
+	case "json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(defs); err != nil {
+			return nil, fmt.Errorf("invalid json: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unknown definition format %q: use yaml or json", format)
+	}
+
+	if err := defs.Validate(); err != nil {
+		return nil, err
+	}
+	return defs, nil
+}
+
+// Validate checks the definitions and reports every problem found, each
+// prefixed with the resource and field it belongs to.
+func (d *Definitions) Validate() error {
+	if len(d.Resources) == 0 {
+		return errors.New("no resources defined")
+	}
+
+	var errs []error
+	names := map[string]bool{}
+	for i, resource := range d.Resources {
+		where := fmt.Sprintf("resources[%d]", i)
+		if resource.Name != "" {
+			where += fmt.Sprintf(" (%s)", resource.Name)
+		}
+
+		if !definitionNamePattern.MatchString(resource.Name) {
+			errs = append(errs, fmt.Errorf("%s: invalid name %q: use lower case letters, digits and underscores", where, resource.Name))
+		} else if names[resource.Name] {
+			errs = append(errs, fmt.Errorf("%s: duplicate resource name", where))
+		}
+		names[resource.Name] = true
+
+		if resource.Path != "" && !strings.HasPrefix(resource.Path, "/") {
+			errs = append(errs, fmt.Errorf("%s: path %q must start with /", where, resource.Path))
+		}
+
+		for _, err := range resource.validate() {
+			errs = append(errs, fmt.Errorf("%s: %w", where, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validate checks the fields, routes and security of the resource.
+func (r ResourceDefinition) validate() []error {
+	var errs []error
+	if len(r.Fields) == 0 {
+		errs = append(errs, errors.New("at least one field is required"))
+	}
+
+	names := map[string]bool{"id": true}
+	goNames := map[string]bool{"ID": true}
+	for i, field := range r.Fields {
+		where := fmt.Sprintf("fields[%d]", i)
+		if field.Name != "" {
+			where += fmt.Sprintf(" (%s)", field.Name)
+		}
+
+		switch {
+		case !definitionNamePattern.MatchString(field.Name):
+			errs = append(errs, fmt.Errorf("%s: invalid name %q: use lower case letters, digits and underscores", where, field.Name))
+		case names[field.Name]:
+			errs = append(errs, fmt.Errorf("%s: duplicate field name, id is reserved", where))
+		case goNames[exportName(field.Name)]:
+			errs = append(errs, fmt.Errorf("%s: name clashes with another field", where))
+		}
+		names[field.Name] = true
+		goNames[exportName(field.Name)] = true
+
+		if _, ok := definitionTypes[field.Type]; !ok {
+			errs = append(errs, fmt.Errorf("%s: unknown type %q: use string, int, float, bool or time", where, field.Type))
+		}
+	}
+
+	if len(errs) == 0 {
+		for i, field := range r.Fields {
+			if err := checkValidateTag(field); err != nil {
+				errs = append(errs, fmt.Errorf("fields[%d] (%s): %w", i, field.Name, err))
+			}
+		}
+	}
+
+	seen := map[Operation]bool{}
+	for _, operation := range r.Routes {
+		known := false
+		for _, candidate := range allOperations {
+			known = known || candidate == operation
+		}
+
+		if !known {
+			errs = append(errs, fmt.Errorf("routes: unknown operation %q: use create, edit, view, list or delete", operation))
+		} else if seen[operation] {
+			errs = append(errs, fmt.Errorf("routes: duplicate operation %q", operation))
+		}
+		seen[operation] = true
+	}
+
+	for _, role := range append(append([]string(nil), r.Security.Roles...), r.Security.WriteRoles...) {
+		if strings.TrimSpace(role) == "" {
+			errs = append(errs, errors.New("security: empty role"))
+		}
+	}
+	return errs
+}
+
+// checkValidateTag validates a zero value of the field with its tag, turning
+// the panic of the validator on unknown or malformed rules into an error.
+func checkValidateTag(field FieldDefinition) (err error) {
+	if field.Validate == "" {
+		return nil
+	}
+
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("invalid validate rules %q: %v", field.Validate, recovered)
+		}
+	}()
+
+	t := reflect.StructOf([]reflect.StructField{{
+		Name: exportName(field.Name),
+		Type: definitionTypes[field.Type],
+		Tag:  reflect.StructTag(fmt.Sprintf(`validate:%q`, field.Validate)),
+	}})
+	_ = validator.New().Struct(reflect.New(t).Interface())
+	return nil
+}
+
+// Register adds the routes of every resource to mux, each backed by its own
+// MemoryStore, and returns the services. Invalid definitions are rejected
+// before any route is added. Echo users pass EchoMux(group).
+func (d *Definitions) Register(mux Mux, opts DefinitionOptions) ([]*APIService, error) {
+	if err := d.Validate(); err != nil {
+		return nil, err
+	}
+
+	for _, resource := range d.Resources {
+		security := resource.Security
+		if (security.Authenticate || len(security.Roles) > 0 || len(security.WriteRoles) > 0) && opts.Authenticator == nil {
+			return nil, fmt.Errorf("resource %q requires authentication but no authenticator was given", resource.Name)
+		}
+	}
+
+	var services []*APIService
+	for _, resource := range d.Resources {
+		services = append(services, resource.register(mux, opts))
+	}
+	return services, nil
+}
+
+// register adds the routes of the resource to mux.
+func (r ResourceDefinition) register(mux Mux, opts DefinitionOptions) *APIService {
+	path := r.Path
+	if path == "" {
+		path = "/" + r.Name
+	}
+
+	table := newRecordTable(r)
+	service := NewAPIServiceWithMux(r.Name, mux.Group(path), opts.Validator, opts.Logger)
+	if opts.Outbox != nil {
+		table.store.Outbox = opts.Outbox
+		service.Events.UseOutbox()
+	}
+	service.NewModel = func() Model { return table.newRecord() }
+
+	routes := r.Routes
+	if len(routes) == 0 {
+		routes = allOperations
+	}
+
+	config := service.Configure().Enable(routes...)
+	for _, operation := range routes {
+		security := r.security(operation, opts)
+		config.Override(operation, OperationConfig{Security: &security})
+
+		method, path := config.Route(operation)
+		route := Route{Operation: operation, Method: method, Path: path, Model: table.newRecord()}
+
+		var handler HandlerFunc
+		switch operation {
+		case OperationCreate:
+			route.Form = table.newForm()
+			handler = func(c Context) error {
+				return CreateServiceRequest{
+					BaseServiceRequest: BaseServiceRequest{Context: c, Model: table.newRecord()},
+					Form:               table.newForm(),
+				}.Create(*service)
+			}
+		case OperationEdit:
+			route.Form = table.newForm()
+			handler = func(c Context) error {
+				return UpdateServiceRequest{
+					BaseServiceRequest: BaseServiceRequest{Context: c, Model: table.newRecord()},
+					Form:               table.newForm(),
+				}.Edit(*service)
+			}
+		case OperationView:
+			handler = func(c Context) error {
+				return ViewServiceRequest{
+					BaseServiceRequest: BaseServiceRequest{Context: c, Model: table.newRecord()},
+				}.View(*service)
+			}
+		case OperationList:
+			route.Filter = newRecordFilter()
+			handler = func(c Context) error {
+				return ListServiceRequest{
+					BaseServiceRequest: BaseServiceRequest{Context: c, Model: table.newRecord()},
+					Filters:            newRecordFilter(),
+				}.List(*service)
+			}
+		case OperationDelete:
+			handler = func(c Context) error {
+				return DeleteServiceRequest{
+					BaseServiceRequest: BaseServiceRequest{Context: c, Model: table.newRecord()},
+				}.Delete(*service)
+			}
+		}
+
+		route.Path = service.Mux.Handle(route.Method, route.Path, handler)
+		service.Describe(route)
+	}
+	return service
+}
+
+// security builds the authenticator and role based authorizer of an operation.
+func (r ResourceDefinition) security(operation Operation, opts DefinitionOptions) Security {
+	roles := r.Security.Roles
+	if operation != OperationView && operation != OperationList && len(r.Security.WriteRoles) > 0 {
+		roles = r.Security.WriteRoles
+	}
+
+	var security Security
+	if r.Security.Authenticate || len(roles) > 0 {
+		security.Authenticator = opts.Authenticator
+	}
+
+	if len(roles) > 0 {
+		security.Authorizer = func(c Context) (bool, error) {
+			return GetPrincipal(c).HasRole(roles...), nil
+		}
+	}
+	return security
+}
+
+// recordTable holds the types and store of a declarative resource.
+type recordTable struct {
+	store      *MemoryStore
+	modelType  reflect.Type
+	formType   reflect.Type
+	filterable map[string]bool
+	sortable   map[string]bool
+}
+
+func newRecordTable(r ResourceDefinition) *recordTable {
+	table := &recordTable{
+		store:      NewMemoryStore(),
+		filterable: map[string]bool{},
+		sortable:   map[string]bool{"id": true},
+	}
+
+	model := []reflect.StructField{{Name: "ID", Type: reflect.TypeOf(""), Tag: `json:"id"`}}
+	var form []reflect.StructField
+	for _, field := range r.Fields {
+		t := definitionTypes[field.Type]
+		model = append(model, reflect.StructField{
+			Name: exportName(field.Name),
+			Type: t,
+			Tag:  reflect.StructTag(fmt.Sprintf(`json:%q`, field.Name)),
+		})
+		form = append(form, reflect.StructField{
+			Name: exportName(field.Name),
+			Type: t,
+			Tag:  reflect.StructTag(fmt.Sprintf(`json:%q validate:%q`, field.Name, field.Validate)),
+		})
+		table.filterable[field.Name] = field.Filterable
+		table.sortable[field.Name] = field.Sortable
+	}
+
+	table.modelType = reflect.StructOf(model)
+	table.formType = reflect.StructOf(form)
+	return table
+}
+
+func (t *recordTable) newRecord() *Record {
+	return &Record{table: t, values: map[string]interface{}{}}
+}
+
+func (t *recordTable) newForm() *recordForm {
+	return &recordForm{Value: reflect.New(t.formType).Interface(), formType: t.formType}
+}
+
+// Record is a model of a declarative resource, stored as a generic JSON object.
+type Record struct {
+	table  *recordTable
+	values map[string]interface{}
+	// tx is the transaction Save and Remove write in, if any.
+	tx *MemoryTx
+}
+
+// Get returns the value of a field.
+func (r *Record) Get(name string) interface{} {
+	return r.values[name]
+}
+
+// JSONType implements JSONTyper.
+func (r *Record) JSONType() reflect.Type {
+	return r.table.modelType
+}
+
+// MarshalJSON encodes the fields of the record.
+func (r *Record) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.values)
+}
+
+// UnmarshalJSON merges the given fields into the record, keeping its id.
+func (r *Record) UnmarshalJSON(data []byte) error {
+	var values map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&values); err != nil {
+		return err
+	}
+
+	for key, value := range values {
+		if key != "id" {
+			r.values[key] = value
+		}
+	}
+	return nil
+}
+
+// Clone copies the record, for the Old record of hooks.
+func (r *Record) Clone() Model {
+	values, _ := copyValue(r.values).(map[string]interface{})
+	return &Record{table: r.table, values: values}
+}
+
+// copyValue deep copies a JSON value.
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		object := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			object[key] = copyValue(item)
+		}
+		return object
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = copyValue(item)
+		}
+		return list
+	default:
+		return v
+	}
+}
+
+// Save stores the record, assigning an id to new records.
+func (r *Record) Save() error {
+	save := r.table.store.Save
+	if r.tx != nil {
+		save = r.tx.Save
+	}
+	r.values["id"] = save(r.values)
+	return nil
+}
+
+// Transaction runs fn in a transaction of the store of the resource, which
+// the record is saved and removed in until fn returns.
+func (r *Record) Transaction(fn func(outbox OutboxWriter) error) error {
+	return r.table.store.Transaction(func(tx *MemoryTx) error {
+		r.tx = tx
+		defer func() { r.tx = nil }()
+		return fn(tx)
+	})
+}
+
+// GetOne loads the record with the given id.
+func (r *Record) GetOne(id interface{}) error {
+	values, ok := r.table.store.Get(fmt.Sprint(id))
+	if !ok {
+		return ErrRecordNotFound
+	}
+	r.values = values
+	return nil
+}
+
+// List returns a page of records. Only filters on filterable fields are
+// applied and only sortable fields may be sorted by.
+func (r *Record) List(filter Filter, pfilter Pagination) (int, int, interface{}, error) {
+	// constraints are set by the server and apply to any field
+	filters := map[string]interface{}{}
+	var constraints map[string]interface{}
+	if constrained, ok := filter.(ConstrainedFilter); ok {
+		filter, constraints = constrained.Filter, constrained.Constraints
+	}
+
+	if filter != nil {
+		for key, value := range filter.GetFilters() {
+			if r.table.filterable[key] {
+				filters[key] = value
+			}
+		}
+	}
+	for key, value := range constraints {
+		filters[key] = value
+	}
+
+	if field := strings.TrimPrefix(pfilter.Sort, "-"); field != "" && !r.table.sortable[field] {
+		return 0, 0, nil, fmt.Errorf("cannot sort by %q", field)
+	}
+
+	totalCounts, totalPages, list := r.table.store.List(filters, pfilter.Sort, pfilter.Limit, pfilter.Page)
+	return totalCounts, totalPages, list, nil
+}
+
+// Remove deletes the record with the given id.
+func (r *Record) Remove(id interface{}) error {
+	remove := r.table.store.Delete
+	if r.tx != nil {
+		remove = r.tx.Delete
+	}
+	if !remove(fmt.Sprint(id)) {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// recordForm is the form of a declarative resource. Value points to a struct
+// built from the field definitions, which the validator checks like any form.
+type recordForm struct {
+	Value    interface{} `json:"-"`
+	formType reflect.Type
+}
+
+// Bind is a no-op: BindStructWithPolicy already copied the form onto the record.
+func (f *recordForm) Bind(Model) error {
+	return nil
+}
+
+// JSONType implements JSONTyper.
+func (f *recordForm) JSONType() reflect.Type {
+	return f.formType
+}
+
+func (f *recordForm) MarshalJSON() ([]byte, error) {
+	return json.Marshal(f.Value)
+}
+
+func (f *recordForm) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, f.Value)
+}
+
+// recordFilter receives every query parameter of a list request; the record
+// keeps those of filterable fields.
+type recordFilter map[string]string
+
+func newRecordFilter() *recordFilter {
+	return &recordFilter{}
+}
+
+// GetFilters implements Filter.
+func (f *recordFilter) GetFilters() map[string]interface{} {
+	filters := make(map[string]interface{}, len(*f))
+	for key, value := range *f {
+		filters[key] = value
+	}
+	return filters
+}
@@ -1,86 +1,176 @@
 package apimaker
 
-import "github.com/labstack/echo/v4"
+import "reflect"
+
+// The helpers register one operation on the configured route of the service.
+// Each request gets its own model, form and filter: models come from NewModel
+// when the service has one, and otherwise, like forms and filters, are new
+// copies of the values passed in, which only serve as prototypes.
 
 func CreateApi(apiService APIService, model Model, form Form) error {
-	apiService.Group.POST("/create", func(c echo.Context) error {
+	method, path, err := apiService.operationRoute(OperationCreate)
+	if err != nil {
+		return err
+	}
+
+	path = apiService.mux().Handle(method, path, func(c Context) error {
 
 		createService := CreateServiceRequest{
 			BaseServiceRequest: BaseServiceRequest{
 				Context: c,
-				Model:   model,
+				Model:   apiService.newModel(model),
 			},
-			Form: form,
+			Form: newInstance(form),
 		}.Create(apiService)
 
 		return createService
 	})
 
+	apiService.Describe(Route{
+		Operation: OperationCreate,
+		Method:    method,
+		Path:      path,
+		Model:     model,
+		Form:      form,
+	})
+
 	return nil
 }
 
 func UpdateApi(apiService APIService, model Model, form Form) error {
-	apiService.Group.PUT("/update/:id", func(c echo.Context) error {
+	method, path, err := apiService.operationRoute(OperationEdit)
+	if err != nil {
+		return err
+	}
+
+	path = apiService.mux().Handle(method, path, func(c Context) error {
 
 		updateService := UpdateServiceRequest{
 			BaseServiceRequest: BaseServiceRequest{
 				Context: c,
-				Model:   model,
+				Model:   apiService.newModel(model),
 			},
-			Form: form,
+			Form: newInstance(form),
 		}.Edit(apiService)
 
 		return updateService
 	})
 
+	apiService.Describe(Route{
+		Operation: OperationEdit,
+		Method:    method,
+		Path:      path,
+		Model:     model,
+		Form:      form,
+	})
+
 	return nil
 }
 
 func ListApi(apiService APIService, model Model, filter Filter) error {
-	apiService.Group.GET("/list", func(c echo.Context) error {
+	method, path, err := apiService.operationRoute(OperationList)
+	if err != nil {
+		return err
+	}
+
+	path = apiService.mux().Handle(method, path, func(c Context) error {
 
 		listService := ListServiceRequest{
 			BaseServiceRequest: BaseServiceRequest{
 				Context: c,
-				Model:   model,
+				Model:   apiService.newModel(model),
 			},
-			Filters: filter,
+			Filters: newInstance(filter),
 		}.List(apiService)
 
 		return listService
 	})
 
+	apiService.Describe(Route{
+		Operation: OperationList,
+		Method:    method,
+		Path:      path,
+		Model:     model,
+		Filter:    filter,
+	})
+
 	return nil
 }
 
 func ViewApi(apiService APIService, model Model, filter Filter) error {
-	apiService.Group.GET("/view/:id", func(c echo.Context) error {
+	method, path, err := apiService.operationRoute(OperationView)
+	if err != nil {
+		return err
+	}
+
+	path = apiService.mux().Handle(method, path, func(c Context) error {
 
 		viewService := ViewServiceRequest{
 			BaseServiceRequest: BaseServiceRequest{
 				Context: c,
-				Model:   model,
+				Model:   apiService.newModel(model),
 			},
 		}.View(apiService)
 
 		return viewService
 	})
 
+	apiService.Describe(Route{
+		Operation: OperationView,
+		Method:    method,
+		Path:      path,
+		Model:     model,
+	})
+
 	return nil
 }
 
 func DeleteApi(apiService APIService, model Model, filter Filter) error {
-	apiService.Group.DELETE("/delete/:id", func(c echo.Context) error {
+	method, path, err := apiService.operationRoute(OperationDelete)
+	if err != nil {
+		return err
+	}
+
+	path = apiService.mux().Handle(method, path, func(c Context) error {
 
 		deleteService := DeleteServiceRequest{
 			BaseServiceRequest: BaseServiceRequest{
 				Context: c,
-				Model:   model,
+				Model:   apiService.newModel(model),
 			},
 		}.Delete(apiService)
 
 		return deleteService
 	})
 
+	apiService.Describe(Route{
+		Operation: OperationDelete,
+		Method:    method,
+		Path:      path,
+		Model:     model,
+	})
+
 	return nil
 }
+
+// newModel returns a model for one request.
+func (a APIService) newModel(prototype Model) Model {
+	if a.NewModel != nil {
+		return a.NewModel()
+	}
+	return newInstance(prototype)
+}
+
+// newInstance returns a new copy of the struct a prototype points to, keeping
+// the dependencies it was set up with, or the prototype itself when it is not
+// a pointer to a struct.
+func newInstance[T any](prototype T) T {
+	v := reflect.ValueOf(prototype)
+	if !v.IsValid() || v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return prototype
+	}
+
+	instance := reflect.New(v.Elem().Type())
+	instance.Elem().Set(v.Elem())
+	return instance.Interface().(T)
+}
@@ -0,0 +1,33 @@
+package apimaker
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestEasyUseHelpersUseNewInstancesPerRequest(t *testing.T) {
+	mux := http.NewServeMux()
+	store := newTestStore()
+	service := newTestService(mux, "item", store)
+	service.NewModel = nil
+	if err := CreateApi(*service, store.model(), new(testItemForm)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, body := range []string{`{"title":"a","tags":["red"]}`, `{"title":"b"}`} {
+		if w := serve(mux, http.MethodPost, "/item/create", body, nil); w.Code != http.StatusOK {
+			t.Fatalf("create = %d: %s", w.Code, w.Body)
+		}
+	}
+
+	if len(store.items) != 2 {
+		t.Fatalf("created %d items, want 2", len(store.items))
+	}
+	second := store.model()
+	if err := second.GetOne("2"); err != nil {
+		t.Fatal(err)
+	}
+	if second.Title != "b" || len(second.Tags) != 0 {
+		t.Errorf("second item = %+v, want title b without tags", second)
+	}
+}
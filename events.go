@@ -0,0 +1,372 @@
+package apimaker
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// EventType names a lifecycle event of a resource.
+type EventType string
+
+const (
+	EventCreated EventType = "created"
+	EventUpdated EventType = "updated"
+	EventDeleted EventType = "deleted"
+	EventViewed  EventType = "viewed"
+	EventListed  EventType = "listed"
+)
+
+// Event is published by the operations of an APIService once they succeeded.
+// Before and After are JSON snapshots of the model: Created and Viewed carry
+// After, Updated carries both and Deleted carries Before when the record could
+// be loaded. Listed carries the applied Filters and the total Count instead.
+type Event struct {
+	ID        string                 `json:"id"`
+	Type      EventType              `json:"type"`
+	Resource  string                 `json:"resource"`
+	RecordID  string                 `json:"record_id,omitempty"`
+	Before    interface{}            `json:"before,omitempty"`
+	After     interface{}            `json:"after,omitempty"`
+	Filters   map[string]interface{} `json:"filters,omitempty"`
+	Count     int                    `json:"count,omitempty"`
+	Principal *Principal             `json:"principal,omitempty"`
+	Time      time.Time              `json:"time"`
+}
+
+// key is the unit events are ordered by: the record, or the resource for Listed.
+func (e Event) key() string {
+	return e.Resource + "/" + e.RecordID
+}
+
+// EventHandler handles an event delivered to a subscriber.
+type EventHandler func(e Event) error
+
+// ErrorPolicy decides what happens when a subscriber fails.
+type ErrorPolicy int
+
+const (
+	// ContinueOnError reports the error and goes on with the next subscriber.
+	ContinueOnError ErrorPolicy = iota
+	// RetryOnError redelivers the event with exponential backoff until
+	// MaxAttempts is reached and then reports the error.
+	RetryOnError
+	// FailOnError makes Publish return the error. A failing synchronous
+	// subscriber turns the response of the operation into a 500, although its
+	// change has already been saved; asynchronous subscribers only report it.
+	FailOnError
+)
+
+// Subscription registers a handler on an EventBus.
+type Subscription struct {
+	// Name identifies the subscriber in error reports.
+	Name string
+	// Types limits the subscription to some event types; empty means all.
+	Types []EventType
+	// Async delivers events on a background goroutine. Events of the same
+	// record are still delivered one at a time, in the order they were published.
+	Async       bool
+	Policy      ErrorPolicy
+	MaxAttempts int
+	// Backoff is the delay before the first retry, doubled for every further one.
+	Backoff time.Duration
+	Handler EventHandler
+
+	queue *eventQueue
+}
+
+func (s *Subscription) wants(t EventType) bool {
+	if len(s.Types) == 0 {
+		return true
+	}
+	for _, candidate := range s.Types {
+		if candidate == t {
+			return true
+		}
+	}
+	return false
+}
+
+// deliver runs the handler, retrying according to the policy.
+func (s *Subscription) deliver(e Event) error {
+	attempts := 1
+	if s.Policy == RetryOnError {
+		attempts = s.MaxAttempts
+		if attempts < 1 {
+			attempts = 3
+		}
+	}
+
+	backoff := s.Backoff
+	if backoff <= 0 {
+		backoff = 100 * time.Millisecond
+	}
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if err = s.Handler(e); err == nil {
+			return nil
+		}
+
+		if attempt < attempts {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+	return err
+}
+
+// EventBus delivers the events of an APIService to its subscribers.
+// Synchronous subscribers run in the request, in subscription order, before
+// the response is written.
+type EventBus struct {
+	// OnError reports subscriber failures; by default they are logged.
+	OnError func(sub *Subscription, e Event, err error)
+
+	mu     sync.RWMutex
+	subs   []*Subscription
+	logger echo.Logger
+	outbox bool
+}
+
+// NewEventBus creates an EventBus logging subscriber failures to logger.
+func NewEventBus(logger echo.Logger) *EventBus {
+	return &EventBus{logger: logger}
+}
+
+// Subscribe registers a subscription and returns a function removing it.
+func (b *EventBus) Subscribe(sub Subscription) (unsubscribe func()) {
+	s := &sub
+	if s.Async {
+		s.queue = &eventQueue{pending: map[string][]Event{}}
+	}
+
+	b.mu.Lock()
+	b.subs = append(b.subs, s)
+	b.mu.Unlock()
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		for i, candidate := range b.subs {
+			if candidate == s {
+				b.subs = append(b.subs[:i:i], b.subs[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// On subscribes a synchronous handler to the given event types, all when none
+// are given.
+func (b *EventBus) On(handler EventHandler, types ...EventType) (unsubscribe func()) {
+	return b.Subscribe(Subscription{Types: types, Handler: handler})
+}
+
+// OnAsync subscribes an asynchronous handler to the given event types, all
+// when none are given.
+func (b *EventBus) OnAsync(handler EventHandler, types ...EventType) (unsubscribe func()) {
+	return b.Subscribe(Subscription{Types: types, Async: true, Handler: handler})
+}
+
+// Wants reports whether any subscriber listens to events of type t, or they
+// go through the outbox, so that operations only take snapshots when they are used.
+func (b *EventBus) Wants(t EventType) bool {
+	if b == nil {
+		return false
+	}
+	if b.outboxed(t) {
+		return true
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, sub := range b.subs {
+		if sub.wants(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// Publish delivers e to the synchronous subscribers and queues it for the
+// asynchronous ones. It returns the first error of a FailOnError subscriber.
+func (b *EventBus) Publish(e Event) error {
+	if e.ID == "" {
+		e.ID = newEventID()
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+
+	b.mu.RLock()
+	subs := append([]*Subscription(nil), b.subs...)
+	b.mu.RUnlock()
+
+	for _, sub := range subs {
+		if !sub.wants(e.Type) {
+			continue
+		}
+
+		if sub.Async {
+			sub := sub
+			sub.queue.push(e.key(), e, func(e Event) {
+				if err := sub.deliver(e); err != nil {
+					b.report(sub, e, err)
+				}
+			})
+			continue
+		}
+
+		if err := sub.deliver(e); err != nil {
+			b.report(sub, e, err)
+			if sub.Policy == FailOnError {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Wait blocks until every queued asynchronous delivery has finished.
+func (b *EventBus) Wait() {
+	b.mu.RLock()
+	subs := append([]*Subscription(nil), b.subs...)
+	b.mu.RUnlock()
+
+	for _, sub := range subs {
+		if sub.queue != nil {
+			sub.queue.wg.Wait()
+		}
+	}
+}
+
+func (b *EventBus) report(sub *Subscription, e Event, err error) {
+	if b.OnError != nil {
+		b.OnError(sub, e, err)
+		return
+	}
+
+	if b.logger != nil {
+		b.logger.Errorf("event subscriber %q failed on %s %s %s: %v", sub.Name, e.Resource, e.Type, e.RecordID, err)
+	}
+}
+
+// eventQueue delivers the events of each key in order, one goroutine per key
+// with pending events.
+type eventQueue struct {
+	mu      sync.Mutex
+	pending map[string][]Event
+	wg      sync.WaitGroup
+}
+
+func (q *eventQueue) push(key string, e Event, deliver func(Event)) {
+	q.mu.Lock()
+	events, running := q.pending[key]
+	q.pending[key] = append(events, e)
+	if !running {
+		q.wg.Add(1)
+	}
+	q.mu.Unlock()
+
+	if running {
+		return
+	}
+
+	go func() {
+		defer q.wg.Done()
+		for {
+			q.mu.Lock()
+			events := q.pending[key]
+			if len(events) == 0 {
+				delete(q.pending, key)
+				q.mu.Unlock()
+				return
+			}
+			next := events[0]
+			q.pending[key] = events[1:]
+			q.mu.Unlock()
+
+			deliver(next)
+		}
+	}()
+}
+
+func newEventID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// snapshotBefore records the model as it was before the operation changed it,
+// when the service has subscribers for events of type t.
+func (s *State) snapshotBefore(t EventType) error {
+	if !s.Service.Events.Wants(t) {
+		return nil
+	}
+
+	before, err := toJSONValue(s.Model)
+	if err != nil {
+		return NewStageError(http.StatusInternalServerError, err, fmt.Sprintf("cannot encode %s", s.Service.Name))
+	}
+	s.Before = before
+	return nil
+}
+
+// publishStage publishes the event of the operation to the event bus of the
+// service, unless it has already been written to the outbox.
+func publishStage(t EventType) Stage {
+	return Stage{Name: StagePublish, Run: func(s *State) error {
+		bus := s.Service.Events
+		if s.outboxed || !bus.Wants(t) {
+			return nil
+		}
+
+		event, err := s.event(t)
+		if err != nil {
+			return err
+		}
+
+		if err := bus.Publish(event); err != nil {
+			return NewStageError(http.StatusInternalServerError, err, fmt.Sprintf("cannot publish %s %s", s.Service.Name, t))
+		}
+		return nil
+	}}
+}
+
+// event describes the operation as an event of type t.
+func (s *State) event(t EventType) (Event, error) {
+	event := Event{
+		Type:      t,
+		Resource:  s.Service.Name,
+		RecordID:  s.ID,
+		Before:    s.Before,
+		Principal: GetPrincipal(s.Context),
+	}
+
+	switch t {
+	case EventCreated, EventUpdated, EventViewed:
+		after, err := toJSONValue(s.Model)
+		if err != nil {
+			return event, NewStageError(http.StatusInternalServerError, err, fmt.Sprintf("cannot encode %s", s.Service.Name))
+		}
+		event.After = after
+
+		if values, ok := after.(map[string]interface{}); ok && event.RecordID == "" && values["id"] != nil {
+			event.RecordID = fmt.Sprint(values["id"])
+		}
+	case EventListed:
+		if s.Filter != nil {
+			event.Filters = s.Filter.GetFilters()
+		}
+		event.Count = s.TotalCounts
+	}
+	return event, nil
+}
@@ -0,0 +1,264 @@
+package apimaker
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// OperationFeed is the operation of the change feed endpoint.
+const OperationFeed Operation = "feed"
+
+// ChangeFeed streams the created, updated and deleted events of a service to
+// Server-Sent Events clients. The latest events are kept in a bounded buffer
+// so that reconnecting clients resume after their Last-Event-ID.
+type ChangeFeed struct {
+	// Heartbeat is the interval of the comments keeping idle connections
+	// open, 15 seconds by default.
+	Heartbeat time.Duration
+
+	service     *APIService
+	size        int
+	mu          sync.Mutex
+	buffer      []Event
+	clients     map[chan Event]struct{}
+	unsubscribe func()
+}
+
+// NewChangeFeed subscribes a feed to the events of service, buffering the
+// latest size events for resumption.
+func NewChangeFeed(service *APIService, size int) *ChangeFeed {
+	if size < 1 {
+		size = 100
+	}
+
+	f := &ChangeFeed{
+		Heartbeat: 15 * time.Second,
+		service:   service,
+		size:      size,
+		clients:   map[chan Event]struct{}{},
+	}
+	f.unsubscribe = service.Events.Subscribe(Subscription{
+		Name:    "feed",
+		Types:   []EventType{EventCreated, EventUpdated, EventDeleted},
+		Handler: f.broadcast,
+	})
+	return f
+}
+
+// Close unsubscribes the feed and disconnects its clients.
+func (f *ChangeFeed) Close() {
+	f.unsubscribe()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for client := range f.clients {
+		close(client)
+		delete(f.clients, client)
+	}
+}
+
+// broadcast buffers e and hands it to the clients. Clients too slow to keep
+// up are disconnected and resume from the buffer when they reconnect.
+func (f *ChangeFeed) broadcast(e Event) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.buffer = append(f.buffer, e)
+	if len(f.buffer) > f.size {
+		f.buffer = append([]Event(nil), f.buffer[len(f.buffer)-f.size:]...)
+	}
+
+	for client := range f.clients {
+		select {
+		case client <- e:
+		default:
+			close(client)
+			delete(f.clients, client)
+		}
+	}
+	return nil
+}
+
+// subscribe registers a client and returns the buffered events after
+// lastEventID: all of them when it is unknown, none when it is empty.
+func (f *ChangeFeed) subscribe(lastEventID string) (chan Event, []Event) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	client := make(chan Event, 64)
+	f.clients[client] = struct{}{}
+
+	if lastEventID == "" {
+		return client, nil
+	}
+	for i, e := range f.buffer {
+		if e.ID == lastEventID {
+			return client, append([]Event(nil), f.buffer[i+1:]...)
+		}
+	}
+	return client, append([]Event(nil), f.buffer...)
+}
+
+func (f *ChangeFeed) leave(client chan Event) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.clients[client]; ok {
+		close(client)
+		delete(f.clients, client)
+	}
+}
+
+// Register adds GET /feed to the routes of the service. It runs the
+// authenticate, authorize, parent and filter stages like List, binding the
+// query string into the filter returned by newFilter, then streams the events
+// whose record matches the filters, compared with its JSON fields. Fields the
+// principal may not read are removed; without a NewModel to check them with,
+// the Before and After snapshots are not sent.
+// newFilter may be nil to stream every event. The feed is guarded by
+// security, or when it is empty by the Security the ResourceConfig of the
+// service gives OperationFeed.
+func (f *ChangeFeed) Register(security Security, newFilter func() Filter) {
+	service := f.service
+	service.mux().Handle(http.MethodGet, "/feed", func(c Context) error {
+		state := &State{Operation: OperationFeed, Service: service, Context: c, Security: service.securityFor(OperationFeed, security)}
+		return service.run(state, []Stage{
+			authenticateStage(),
+			authorizeStage(),
+			parentStage(),
+			{Name: StageFilter, Run: func(s *State) error {
+				var filter Filter
+				if newFilter != nil {
+					filter = newFilter()
+					if err := s.Context.Bind(filter); err != nil {
+						return NewStageError(http.StatusBadRequest, err, fmt.Sprintf("cannot bind %s filter", service.Name))
+					}
+				}
+				s.Filter = service.scopeFilter(filter, s.ParentID)
+				return nil
+			}},
+			{Name: StageRespond, Run: f.stream},
+		}, nil)
+	})
+}
+
+// stream writes the events to the client until it disconnects.
+func (f *ChangeFeed) stream(s *State) error {
+	w, ok := responseWriter(s.Context)
+	flusher, canFlush := w.(http.Flusher)
+	if !ok || !canFlush {
+		return NewStageError(http.StatusInternalServerError, nil, "streaming is not supported")
+	}
+
+	var filters map[string]interface{}
+	if s.Filter != nil {
+		filters = s.Filter.GetFilters()
+	}
+
+	client, replay := f.subscribe(s.Context.Request().Header.Get("Last-Event-ID"))
+	defer f.leave(client)
+
+	header := w.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	send := func(e Event) error {
+		if !f.matches(e, filters) {
+			return nil
+		}
+
+		e, err := f.render(s.Context, e)
+		if err != nil {
+			return err
+		}
+
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+
+	for _, e := range replay {
+		if err := send(e); err != nil {
+			return ErrResponded
+		}
+	}
+
+	heartbeat := f.Heartbeat
+	if heartbeat <= 0 {
+		heartbeat = 15 * time.Second
+	}
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+
+	done := s.Context.Request().Context().Done()
+	for {
+		select {
+		case <-done:
+			return ErrResponded
+		case e, open := <-client:
+			if !open {
+				return ErrResponded
+			}
+			if err := send(e); err != nil {
+				return ErrResponded
+			}
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return ErrResponded
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// matches compares the filters with the record of the event, as it was
+// before a delete and after any other change.
+func (f *ChangeFeed) matches(e Event, filters map[string]interface{}) bool {
+	if len(filters) == 0 {
+		return true
+	}
+
+	record := e.After
+	if e.Type == EventDeleted {
+		record = e.Before
+	}
+	values, ok := record.(map[string]interface{})
+	return ok && matchesFilters(values, filters)
+}
+
+// render removes the principal of the event, which identifies another user,
+// and the fields of the snapshots the principal of the request may not read.
+// The snapshots are left out when the service has no NewModel to check them
+// with.
+func (f *ChangeFeed) render(c Context, e Event) (Event, error) {
+	e.Principal = nil
+	if f.service.NewModel == nil {
+		e.Before, e.After = nil, nil
+		return e, nil
+	}
+
+	model := f.service.NewModel()
+	var err error
+	if e.Before != nil {
+		if e.Before, err = f.service.renderValue(c, e.Before, model, nil, nil); err != nil {
+			return e, err
+		}
+	}
+	if e.After != nil {
+		if e.After, err = f.service.renderValue(c, e.After, model, nil, nil); err != nil {
+			return e, err
+		}
+	}
+	return e, nil
+}
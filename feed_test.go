@@ -0,0 +1,89 @@
+package apimaker
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestChangeFeedRendersSnapshots(t *testing.T) {
+	service := NewHTTPAPIService("secret", http.NewServeMux(), "/secret", testValidator{}, nil)
+	feed := NewChangeFeed(service, 10)
+	e := Event{Type: EventUpdated, Resource: "secret", Before: &secretItem{Secret: "old"}, After: &secretItem{Secret: "new"}}
+	c := NewHTTPContext(nil, nil, nil, nil)
+
+	rendered, err := feed.render(c, e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rendered.Before != nil || rendered.After != nil {
+		t.Errorf("snapshots sent without a NewModel: %v, %v", rendered.Before, rendered.After)
+	}
+
+	service.NewModel = func() Model { return new(secretItem) }
+	if rendered, err = feed.render(c, e); err != nil {
+		t.Fatal(err)
+	}
+	if after, _ := rendered.After.(map[string]interface{}); after == nil || after["secret"] != nil {
+		t.Errorf("after = %v, want the readable fields only", rendered.After)
+	}
+}
+
+func TestChangeFeedStreamsEventsWithoutPrincipal(t *testing.T) {
+	mux := http.NewServeMux()
+	service := NewHTTPAPIService("secret", mux, "/secret", testValidator{}, nil)
+	service.NewModel = func() Model { return new(secretItem) }
+	NewChangeFeed(service, 10).Register(Security{}, nil)
+
+	if err := service.Events.Publish(Event{
+		Type:      EventCreated,
+		Resource:  "secret",
+		RecordID:  "1",
+		After:     &secretItem{ID: "1", Name: "a"},
+		Principal: &Principal{ID: "alice", Roles: []string{"admin"}, Claims: map[string]interface{}{"token": "t"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/secret/feed", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// an unknown id replays the buffered events
+	req.Header.Set("Last-Event-ID", "unknown")
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+		if !ok {
+			continue
+		}
+
+		var streamed map[string]interface{}
+		if err := json.Unmarshal([]byte(data), &streamed); err != nil {
+			t.Fatal(err)
+		}
+		if _, found := streamed["principal"]; found {
+			t.Errorf("streamed event has the principal: %s", data)
+		}
+		if streamed["record_id"] != "1" {
+			t.Errorf("streamed event = %s", data)
+		}
+		return
+	}
+	t.Fatalf("no event streamed: %v", scanner.Err())
+}
@@ -0,0 +1,189 @@
+package apimaker
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// FieldSelector is implemented by models that can load only a subset of their
+// fields, for example by selecting fewer columns from a SQL table. The fields
+// are json names and may contain dotted paths for nested objects.
+type FieldSelector interface {
+	SelectFields(fields []string)
+}
+
+// ParseFields reads the comma separated "fields" query parameter.
+func ParseFields(c Context) []string {
+	return queryList(c, "fields")
+}
+
+// queryList splits a comma separated query parameter into its trimmed items.
+func queryList(c Context, name string) []string {
+	raw := c.QueryParam(name)
+	if raw == "" {
+		return nil
+	}
+
+	var items []string
+	for _, item := range strings.Split(raw, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// ValidateFields checks that every field path refers to a public json field of
+// the model. Nested objects are addressed with dotted paths like "supplier.name".
+func ValidateFields(model interface{}, fields []string) error {
+	root := jsonType(model)
+	for _, path := range fields {
+		t := root
+		for _, name := range strings.Split(path, ".") {
+			t = elemType(t)
+			if t == nil || t.Kind() == reflect.Interface || t.Kind() == reflect.Map {
+				break
+			}
+
+			if t.Kind() != reflect.Struct {
+				return fmt.Errorf("unknown field %q", path)
+			}
+
+			f, ok := lookupJSONField(t, name)
+			if !ok {
+				return fmt.Errorf("unknown field %q", path)
+			}
+			t = f.Field.Type
+		}
+	}
+	return nil
+}
+
+// ProjectFields keeps only the given field paths of a generic JSON value.
+// Slices are projected element by element.
+func ProjectFields(value interface{}, fields []string) interface{} {
+	if len(fields) == 0 {
+		return value
+	}
+	return project(value, buildFieldTree(fields))
+}
+
+// fieldTree is a parsed set of dotted field paths. A nil subtree keeps the
+// whole value.
+type fieldTree map[string]fieldTree
+
+func buildFieldTree(fields []string) fieldTree {
+	tree := fieldTree{}
+	for _, path := range fields {
+		node := tree
+		parts := strings.Split(path, ".")
+		for i, name := range parts {
+			child, seen := node[name]
+			if seen && child == nil {
+				// the whole value is already selected
+				break
+			}
+			if i == len(parts)-1 {
+				node[name] = nil
+				break
+			}
+			if child == nil {
+				child = fieldTree{}
+				node[name] = child
+			}
+			node = child
+		}
+	}
+	return tree
+}
+
+func project(value interface{}, tree fieldTree) interface{} {
+	if tree == nil {
+		return value
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(tree))
+		for name, sub := range tree {
+			if field, ok := v[name]; ok {
+				out[name] = project(field, sub)
+			}
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, item := range v {
+			out[i] = project(item, tree)
+		}
+		return out
+	default:
+		return value
+	}
+}
+
+// elemType strips pointers, slices and arrays from t to reach the type of a
+// single element.
+func elemType(t reflect.Type) reflect.Type {
+	for t != nil {
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Array:
+			t = t.Elem()
+		default:
+			return t
+		}
+	}
+	return nil
+}
+
+// selectFields validates the requested fields against the model and passes
+// them down to models implementing FieldSelector.
+func selectFields(model Model, fields []string) error {
+	if len(fields) == 0 {
+		return nil
+	}
+
+	if err := ValidateFields(model, fields); err != nil {
+		return err
+	}
+
+	if selector, ok := model.(FieldSelector); ok {
+		selector.SelectFields(fields)
+	}
+	return nil
+}
+
+// renderValue converts v to JSON form, removes the fields the principal may
+// not read according to the api tags of model, embeds the included relations
+// and applies the requested fields. v is either the model itself or a list of
+// models of the same type.
+func (a *APIService) renderValue(c Context, v interface{}, model interface{}, fields []string, includes []Relation) (interface{}, error) {
+	t := reflect.TypeOf(model)
+	restricted := hasAccessRules(t)
+	if len(fields) == 0 && len(includes) == 0 && !restricted {
+		return v, nil
+	}
+
+	value, err := toJSONValue(v)
+	if err != nil {
+		return nil, err
+	}
+
+	if restricted {
+		value = stripUnreadable(value, t, GetPrincipal(c))
+	}
+
+	if len(includes) > 0 {
+		if err := embedRelations(c, value, includes); err != nil {
+			return nil, err
+		}
+
+		if len(fields) > 0 {
+			for _, relation := range includes {
+				fields = append(fields, relation.Name)
+			}
+		}
+	}
+	return ProjectFields(value, fields), nil
+}
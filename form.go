@@ -7,3 +7,61 @@ type Form interface {
 type Filter interface {
 	GetFilters() map[string]interface{}
 }
+
+// ConstrainedFilter adds mandatory constraints to the filters of another
+// Filter. Constraints always win over values sent by the client.
+type ConstrainedFilter struct {
+	Filter      Filter
+	Constraints map[string]interface{}
+}
+
+// WithConstraints wraps filter so that GetFilters always includes constraints.
+func WithConstraints(filter Filter, constraints map[string]interface{}) Filter {
+	if existing, ok := filter.(ConstrainedFilter); ok {
+		merged := make(map[string]interface{}, len(existing.Constraints)+len(constraints))
+		for key, value := range existing.Constraints {
+			merged[key] = value
+		}
+		for key, value := range constraints {
+			merged[key] = value
+		}
+		return ConstrainedFilter{Filter: existing.Filter, Constraints: merged}
+	}
+	return ConstrainedFilter{Filter: filter, Constraints: constraints}
+}
+
+// GetFilters returns the filters of the wrapped Filter merged with the constraints.
+func (f ConstrainedFilter) GetFilters() map[string]interface{} {
+	filters := make(map[string]interface{})
+	if f.Filter != nil {
+		for key, value := range f.Filter.GetFilters() {
+			filters[key] = value
+		}
+	}
+
+	for key, value := range f.Constraints {
+		filters[key] = value
+	}
+	return filters
+}
+
+// Unwrap returns the client supplied Filter.
+func (f ConstrainedFilter) Unwrap() Filter {
+	return f.Filter
+}
+
+// UnwrapFilter returns the Filter bound from the request, removing the
+// ConstrainedFilter the stages may have wrapped it in. Models type asserting
+// their filter should assert the result, and still query GetFilters of the
+// original filter so that the constraints apply:
+//
+//	if f, ok := apimaker.UnwrapFilter(filter).(*ProductFilter); ok { ... }
+func UnwrapFilter(filter Filter) Filter {
+	for {
+		constrained, ok := filter.(ConstrainedFilter)
+		if !ok {
+			return filter
+		}
+		filter = constrained.Filter
+	}
+}
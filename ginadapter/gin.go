@@ -0,0 +1,43 @@
+// Package ginadapter registers api_maker services on a gin router group. It
+// is a module of its own so that api_maker itself does not depend on gin.
+package ginadapter
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labstack/echo/v4"
+	apimaker "github.com/yasinsaee/api_maker"
+)
+
+// mux registers routes on a gin router group.
+type mux struct {
+	group     *gin.RouterGroup
+	validator echo.Validator
+}
+
+// Mux adapts a gin router group, for example engine.Group("/api").
+// Requests are validated with validator.
+func Mux(group *gin.RouterGroup, validator echo.Validator) apimaker.Mux {
+	return mux{group: group, validator: validator}
+}
+
+// NewAPIService creates an APIService registering its routes on group.
+func NewAPIService(name string, group *gin.RouterGroup, validator echo.Validator, logger echo.Logger) *apimaker.APIService {
+	return apimaker.NewAPIServiceWithMux(name, Mux(group, validator), validator, logger)
+}
+
+func (m mux) Handle(method, path string, h apimaker.HandlerFunc) string {
+	m.group.Handle(method, path, func(gc *gin.Context) {
+		params := make(map[string]string, len(gc.Params))
+		for _, param := range gc.Params {
+			params[param.Key] = param.Value
+		}
+		apimaker.ServeHTTPContext(apimaker.NewHTTPContext(gc.Writer, gc.Request, params, m.validator), h)
+	})
+	return strings.TrimSuffix(m.group.BasePath(), "/") + path
+}
+
+func (m mux) Group(prefix string) apimaker.Mux {
+	return mux{group: m.group.Group(prefix), validator: m.validator}
+}
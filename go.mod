@@ -4,7 +4,9 @@ go 1.22.1
 
 require (
 	github.com/go-playground/validator/v10 v10.21.0
+	github.com/golang-jwt/jwt/v5 v5.3.1
 	github.com/labstack/echo/v4 v4.11.4
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
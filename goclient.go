@@ -0,0 +1,479 @@
+package apimaker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// GenerateGoClient writes a typed Go client package for the routes recorded
+// on the given services. Each resource gets a client with Create, Edit, View,
+// List and Delete methods using Go types reflected from its model, form and
+// filter; responses are unwrapped from the Response envelope and failures are
+// returned as *Error values. It is meant to be called from a small program
+// run by go generate.
+func GenerateGoClient(w io.Writer, pkg string, services ...*APIService) error {
+	types := newGoTypeWriter()
+	meta := types.typeExpr(reflect.TypeOf(MetaData{}))
+	pagination := types.typeExpr(reflect.TypeOf(Pagination{}))
+
+	var resources []goClientResource
+	for _, service := range services {
+		resource := goClientResource{
+			Name:   exportName(service.Name),
+			Key:    service.Name,
+			Client: exportName(service.Name) + "Client",
+		}
+
+		seen := map[Operation]bool{}
+		for _, route := range service.Routes() {
+			if seen[route.Operation] {
+				continue
+			}
+			seen[route.Operation] = true
+
+			method := goClientMethod{
+				Operation: string(route.Operation),
+				Method:    route.Method,
+				Model:     types.typeExpr(indirectType(jsonType(route.Model))),
+			}
+			method.Path, method.Params = goClientPath(route.Path)
+			if route.Form != nil {
+				method.Form = types.typeExpr(indirectType(jsonType(route.Form)))
+			}
+			if route.Filter != nil {
+				method.Filter = types.typeExpr(indirectType(jsonType(route.Filter)))
+			}
+			resource.Methods = append(resource.Methods, method)
+		}
+		resources = append(resources, resource)
+	}
+
+	// rendering the declarations discovers nested types and their imports
+	declarations := types.declarations()
+
+	var src bytes.Buffer
+	err := goClientTemplate.Execute(&src, map[string]interface{}{
+		"Package":    pkg,
+		"Imports":    types.sortedImports(),
+		"Types":      declarations,
+		"MetaData":   meta,
+		"Pagination": pagination,
+		"Resources":  resources,
+	})
+	if err != nil {
+		return err
+	}
+
+	formatted, err := format.Source(src.Bytes())
+	if err != nil {
+		return fmt.Errorf("cannot format generated client: %w", err)
+	}
+
+	_, err = w.Write(formatted)
+	return err
+}
+
+type goClientResource struct {
+	Name    string
+	Key     string
+	Client  string
+	Methods []goClientMethod
+}
+
+type goClientMethod struct {
+	Operation string
+	Method    string
+	// Path is a Go expression building the request path from Params.
+	Path   string
+	Params []string
+	Model  string
+	Form   string
+	Filter string
+}
+
+// goClientPath turns an echo path into a Go expression building it and the
+// names of its parameters.
+func goClientPath(path string) (string, []string) {
+	var params, args []string
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			name := goIdent(segment[1:])
+			params = append(params, name)
+			args = append(args, "url.PathEscape("+name+")")
+			segments[i] = "%s"
+		}
+	}
+
+	if len(params) == 0 {
+		return strconv.Quote(path), nil
+	}
+	return fmt.Sprintf("fmt.Sprintf(%q, %s)", strings.Join(segments, "/"), strings.Join(args, ", ")), params
+}
+
+// goIdent makes a route parameter usable as a Go parameter name.
+func goIdent(name string) string {
+	name = exportName(name)
+	if name == "" {
+		return "param"
+	}
+	return strings.ToLower(name[:1]) + name[1:]
+}
+
+// goTypeWriter reflects Go types into declarations for the generated package.
+type goTypeWriter struct {
+	names   map[reflect.Type]string
+	taken   map[string]bool
+	order   []reflect.Type
+	imports map[string]bool
+}
+
+func newGoTypeWriter() *goTypeWriter {
+	return &goTypeWriter{
+		names:   map[reflect.Type]string{},
+		taken:   map[string]bool{"Client": true, "Error": true, "Option": true, "envelope": true},
+		imports: map[string]bool{},
+	}
+}
+
+var jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+
+// typeExpr returns the Go expression for t, declaring named struct types.
+func (w *goTypeWriter) typeExpr(t reflect.Type) string {
+	if t == nil {
+		return "json.RawMessage"
+	}
+
+	switch {
+	case t.Kind() == reflect.Ptr:
+		return "*" + w.typeExpr(t.Elem())
+	case t == timeType:
+		w.imports["time"] = true
+		return "time.Time"
+	case t.Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(jsonMarshalerType):
+		return "json.RawMessage"
+	case t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType):
+		return "string"
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if t.Name() == "" {
+			return "struct {\n" + w.fields(t) + "}"
+		}
+		return w.declare(t)
+	case reflect.Slice:
+		return "[]" + w.typeExpr(t.Elem())
+	case reflect.Array:
+		return fmt.Sprintf("[%d]%s", t.Len(), w.typeExpr(t.Elem()))
+	case reflect.Map:
+		return "map[" + w.typeExpr(t.Key()) + "]" + w.typeExpr(t.Elem())
+	case reflect.Interface, reflect.Func, reflect.Chan, reflect.UnsafePointer, reflect.Invalid:
+		return "interface{}"
+	}
+	return t.Kind().String()
+}
+
+// declare registers a named struct type and returns its name in the client.
+func (w *goTypeWriter) declare(t reflect.Type) string {
+	if name, ok := w.names[t]; ok {
+		return name
+	}
+
+	name := t.Name()
+	if w.taken[name] {
+		pkg := t.PkgPath()
+		name = exportName(pkg[strings.LastIndex(pkg, "/")+1:]) + name
+	}
+	w.taken[name] = true
+	w.names[t] = name
+	w.order = append(w.order, t)
+	return name
+}
+
+// fields renders the struct fields of t with their json and query tags.
+func (w *goTypeWriter) fields(t reflect.Type) string {
+	var b strings.Builder
+	for _, f := range jsonFields(t) {
+		var tags []string
+		for _, key := range []string{"json", "query"} {
+			if value, ok := f.Field.Tag.Lookup(key); ok {
+				tags = append(tags, fmt.Sprintf("%s:%q", key, value))
+			}
+		}
+
+		fmt.Fprintf(&b, "\t%s %s", f.Field.Name, w.typeExpr(f.Field.Type))
+		if len(tags) > 0 {
+			fmt.Fprintf(&b, " `%s`", strings.Join(tags, " "))
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// declarations renders every declared struct type, including the ones
+// discovered while rendering others.
+func (w *goTypeWriter) declarations() string {
+	var b strings.Builder
+	for i := 0; i < len(w.order); i++ {
+		t := w.order[i]
+		fmt.Fprintf(&b, "// %s mirrors %s.\ntype %s struct {\n%s}\n\n", w.names[t], t.String(), w.names[t], w.fields(t))
+	}
+	return b.String()
+}
+
+func (w *goTypeWriter) sortedImports() []string {
+	var imports []string
+	for path := range w.imports {
+		imports = append(imports, path)
+	}
+	sort.Strings(imports)
+	return imports
+}
+
+var goClientTemplate = template.Must(template.New("goclient").Parse(`// Code generated by apimaker. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+{{range .Imports}}	"{{.}}"
+{{end}})
+
+{{.Types}}
+// Error is returned when the API answers with an error response.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("api error %d: %s", e.StatusCode, e.Message)
+}
+
+// Option adjusts the query of a View or List request.
+type Option func(url.Values)
+
+// WithFields limits the response to the given json fields.
+func WithFields(fields ...string) Option {
+	return func(q url.Values) { q.Set("fields", strings.Join(fields, ",")) }
+}
+
+// WithInclude embeds the given related resources in the response.
+func WithInclude(relations ...string) Option {
+	return func(q url.Values) { q.Set("include", strings.Join(relations, ",")) }
+}
+
+// Client calls the API at BaseURL.
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+	// Header is sent with every request, for example to carry an Authorization token.
+	Header http.Header
+}
+
+// New creates a client for the API at baseURL.
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		HTTPClient: http.DefaultClient,
+		Header:     http.Header{},
+	}
+}
+
+type envelope struct {
+	Code           int                        ` + "`json:\"code\"`" + `
+	SuccessMessage string                     ` + "`json:\"success_message\"`" + `
+	ErrorMessage   string                     ` + "`json:\"error_message\"`" + `
+	Data           map[string]json.RawMessage ` + "`json:\"data\"`" + `
+	MetaData       {{.MetaData}}              ` + "`json:\"metadata\"`" + `
+}
+
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body interface{}) (*envelope, error) {
+	var reader *bytes.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(raw)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	target := c.BaseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range c.Header {
+		req.Header[key] = values
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	env := new(envelope)
+	if err := json.NewDecoder(resp.Body).Decode(env); err != nil {
+		if resp.StatusCode >= http.StatusBadRequest {
+			return nil, &Error{StatusCode: resp.StatusCode, Message: resp.Status}
+		}
+		return nil, err
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, &Error{StatusCode: resp.StatusCode, Message: env.ErrorMessage}
+	}
+	return env, nil
+}
+
+func (env *envelope) decode(key string, out interface{}) error {
+	raw, ok := env.Data[key]
+	if !ok {
+		return fmt.Errorf("response has no %q data", key)
+	}
+	return json.Unmarshal(raw, out)
+}
+
+// encodeQuery adds the non-zero query tagged fields of v to q.
+func encodeQuery(q url.Values, v interface{}) {
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if !rv.IsValid() || rv.Kind() != reflect.Struct {
+		return
+	}
+
+	for i := 0; i < rv.NumField(); i++ {
+		field := rv.Field(i)
+		name := rv.Type().Field(i).Tag.Get("query")
+		if name == "" {
+			if field.Kind() == reflect.Struct {
+				encodeQuery(q, field.Interface())
+			}
+			continue
+		}
+		if field.IsZero() {
+			continue
+		}
+
+		field = reflect.Indirect(field)
+		if field.Kind() == reflect.Slice {
+			for j := 0; j < field.Len(); j++ {
+				q.Add(name, fmt.Sprint(field.Index(j).Interface()))
+			}
+			continue
+		}
+		q.Set(name, fmt.Sprint(field.Interface()))
+	}
+}
+{{range $r := .Resources}}
+// {{$r.Client}} calls the {{$r.Key}} resource.
+type {{$r.Client}} struct {
+	client *Client
+}
+
+// {{$r.Name}} returns the client of the {{$r.Key}} resource.
+func (c *Client) {{$r.Name}}() *{{$r.Client}} {
+	return &{{$r.Client}}{client: c}
+}
+{{range $m := $r.Methods}}{{if eq $m.Operation "create"}}
+// Create adds a new {{$r.Key}}.
+func (r *{{$r.Client}}) Create(ctx context.Context{{range $m.Params}}, {{.}} string{{end}}, form {{$m.Form}}) (*{{$m.Model}}, error) {
+	env, err := r.client.do(ctx, "{{$m.Method}}", {{$m.Path}}, nil, form)
+	if err != nil {
+		return nil, err
+	}
+
+	out := new({{$m.Model}})
+	if err := env.decode("{{$r.Key}}", out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+{{else if eq $m.Operation "edit"}}
+// Edit updates an existing {{$r.Key}}.
+func (r *{{$r.Client}}) Edit(ctx context.Context{{range $m.Params}}, {{.}} string{{end}}, form {{$m.Form}}) (*{{$m.Model}}, error) {
+	env, err := r.client.do(ctx, "{{$m.Method}}", {{$m.Path}}, nil, form)
+	if err != nil {
+		return nil, err
+	}
+
+	out := new({{$m.Model}})
+	if err := env.decode("{{$r.Key}}", out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+{{else if eq $m.Operation "view"}}
+// View loads a single {{$r.Key}}.
+func (r *{{$r.Client}}) View(ctx context.Context{{range $m.Params}}, {{.}} string{{end}}, opts ...Option) (*{{$m.Model}}, error) {
+	query := url.Values{}
+	for _, opt := range opts {
+		opt(query)
+	}
+
+	env, err := r.client.do(ctx, "{{$m.Method}}", {{$m.Path}}, query, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	out := new({{$m.Model}})
+	if err := env.decode("{{$r.Key}}", out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+{{else if eq $m.Operation "list"}}
+// List loads a page of {{$r.Key}} records matching the filter.
+func (r *{{$r.Client}}) List(ctx context.Context{{range $m.Params}}, {{.}} string{{end}}{{if $m.Filter}}, filter {{$m.Filter}}{{end}}, page {{$.Pagination}}, opts ...Option) ([]{{$m.Model}}, {{$.MetaData}}, error) {
+	query := url.Values{}
+{{- if $m.Filter}}
+	encodeQuery(query, filter)
+{{- end}}
+	encodeQuery(query, page)
+	for _, opt := range opts {
+		opt(query)
+	}
+
+	env, err := r.client.do(ctx, "{{$m.Method}}", {{$m.Path}}, query, nil)
+	if err != nil {
+		return nil, {{$.MetaData}}{}, err
+	}
+
+	var out []{{$m.Model}}
+	if err := env.decode("{{$r.Key}}s", &out); err != nil {
+		return nil, {{$.MetaData}}{}, err
+	}
+	return out, env.MetaData, nil
+}
+{{else if eq $m.Operation "delete"}}
+// Delete removes a {{$r.Key}}.
+func (r *{{$r.Client}}) Delete(ctx context.Context{{range $m.Params}}, {{.}} string{{end}}) error {
+	_, err := r.client.do(ctx, "{{$m.Method}}", {{$m.Path}}, nil, nil)
+	return err
+}
+{{end}}{{end}}{{end}}`))
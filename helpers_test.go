@@ -0,0 +1,168 @@
+package apimaker
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testValidator accepts every form.
+type testValidator struct{}
+
+func (testValidator) Validate(i interface{}) error { return nil }
+
+// newTestResources registers declarative resources on a net/http mux.
+func newTestResources(t *testing.T, definitions string, opts DefinitionOptions) (*http.ServeMux, []*APIService) {
+	t.Helper()
+
+	defs, err := ParseDefinitions([]byte(definitions), "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	opts.Validator = testValidator{}
+	services, err := defs.Register(HTTPMux(mux, "", opts.Validator), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mux, services
+}
+
+// serve sends a JSON request to h.
+func serve(h http.Handler, method, path, body string, header http.Header) *httptest.ResponseRecorder {
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+
+	r := httptest.NewRequest(method, path, reader)
+	r.Header.Set("Content-Type", "application/json")
+	for key, values := range header {
+		r.Header[key] = values
+	}
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+// testStore keeps testItems in memory.
+type testStore struct {
+	mu    sync.Mutex
+	items map[string][]byte
+	next  int
+}
+
+func newTestStore() *testStore {
+	return &testStore{items: map[string][]byte{}}
+}
+
+// model returns an empty item of the store.
+func (s *testStore) model() *testItem {
+	return &testItem{store: s}
+}
+
+// testItem is a struct model with slice and map fields.
+type testItem struct {
+	ID      string            `json:"id"`
+	Title   string            `json:"title"`
+	StoreID string            `json:"store_id,omitempty"`
+	Owner   string            `json:"owner,omitempty"`
+	Tags    []string          `json:"tags,omitempty"`
+	Meta    map[string]string `json:"meta,omitempty"`
+	store   *testStore
+}
+
+func (m *testItem) Save() error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	if m.ID == "" {
+		m.store.next++
+		m.ID = fmt.Sprint(m.store.next)
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	m.store.items[m.ID] = data
+	return nil
+}
+
+func (m *testItem) GetOne(id interface{}) error {
+	m.store.mu.Lock()
+	data, ok := m.store.items[fmt.Sprint(id)]
+	m.store.mu.Unlock()
+	if !ok {
+		return ErrRecordNotFound
+	}
+	return json.Unmarshal(data, m)
+}
+
+func (m *testItem) List(filter Filter, pagination Pagination) (int, int, interface{}, error) {
+	var filters map[string]interface{}
+	if filter != nil {
+		filters = filter.GetFilters()
+	}
+
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	items := []testItem{}
+	for _, data := range m.store.items {
+		var values map[string]interface{}
+		json.Unmarshal(data, &values)
+		if matchesFilters(values, filters) {
+			var item testItem
+			json.Unmarshal(data, &item)
+			items = append(items, item)
+		}
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].ID < items[j].ID })
+	return len(items), 1, items, nil
+}
+
+func (m *testItem) Remove(id interface{}) error {
+	m.store.mu.Lock()
+	defer m.store.mu.Unlock()
+	if _, ok := m.store.items[fmt.Sprint(id)]; !ok {
+		return ErrRecordNotFound
+	}
+	delete(m.store.items, fmt.Sprint(id))
+	return nil
+}
+
+// testItemForm binds every field of a testItem but its id.
+type testItemForm struct {
+	Title   string            `json:"title"`
+	StoreID string            `json:"store_id,omitempty"`
+	Owner   string            `json:"owner,omitempty"`
+	Tags    []string          `json:"tags,omitempty"`
+	Meta    map[string]string `json:"meta,omitempty"`
+}
+
+func (f *testItemForm) Bind(Model) error { return nil }
+
+// testItemFilter filters items by title.
+type testItemFilter struct {
+	Title string `query:"title"`
+}
+
+func (f *testItemFilter) GetFilters() map[string]interface{} {
+	if f.Title == "" {
+		return map[string]interface{}{}
+	}
+	return map[string]interface{}{"title": f.Title}
+}
+
+// newTestService creates a service of testItems below /name of mux.
+func newTestService(mux *http.ServeMux, name string, store *testStore) *APIService {
+	service := NewHTTPAPIService(name, mux, "/"+name, testValidator{}, nil)
+	service.NewModel = func() Model { return store.model() }
+	return service
+}
@@ -0,0 +1,295 @@
+package apimaker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// OperationHistory is the operation of the history endpoints.
+const OperationHistory Operation = "history"
+
+// revertKey is the context key the restored revision number is stored under.
+const revertKey = "apimaker.revert"
+
+// ErrRevisionNotFound is returned by a RevisionStore for unknown revisions.
+var ErrRevisionNotFound = errors.New("revision not found")
+
+// Revision is a snapshot of a record after one of its edits. Revision 1 is
+// the record as it was before its first edit.
+type Revision struct {
+	Resource    string      `json:"resource"`
+	RecordID    string      `json:"record_id"`
+	Number      int         `json:"number"`
+	Snapshot    interface{} `json:"snapshot"`
+	PrincipalID string      `json:"principal_id,omitempty"`
+	// RevertOf is the number of the revision restored by this one.
+	RevertOf int       `json:"revert_of,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// RevisionStore persists revisions.
+type RevisionStore interface {
+	// AddRevision stores rev, numbering it after the last revision of its record.
+	AddRevision(rev *Revision) error
+	// Revisions returns one page of the revisions of a record, newest first,
+	// and their total count. A limit below one returns all of them.
+	Revisions(resource, recordID string, limit, page int) (int, []Revision, error)
+	// Revision returns a revision or ErrRevisionNotFound.
+	Revision(resource, recordID string, number int) (*Revision, error)
+}
+
+// MemoryRevisionStore is a RevisionStore kept in memory.
+type MemoryRevisionStore struct {
+	mu        sync.RWMutex
+	revisions map[string][]Revision
+}
+
+// NewMemoryRevisionStore creates an empty MemoryRevisionStore.
+func NewMemoryRevisionStore() *MemoryRevisionStore {
+	return &MemoryRevisionStore{revisions: map[string][]Revision{}}
+}
+
+func (s *MemoryRevisionStore) AddRevision(rev *Revision) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := rev.Resource + "/" + rev.RecordID
+	rev.Number = len(s.revisions[key]) + 1
+	s.revisions[key] = append(s.revisions[key], *rev)
+	return nil
+}
+
+func (s *MemoryRevisionStore) Revisions(resource, recordID string, limit, page int) (int, []Revision, error) {
+	s.mu.RLock()
+	revisions := append([]Revision(nil), s.revisions[resource+"/"+recordID]...)
+	s.mu.RUnlock()
+
+	sort.Slice(revisions, func(i, j int) bool { return revisions[i].Number > revisions[j].Number })
+
+	total := len(revisions)
+	if limit < 1 {
+		return total, revisions, nil
+	}
+
+	if page < 1 {
+		page = 1
+	}
+	start := (page - 1) * limit
+	if start > total {
+		start = total
+	}
+	end := start + limit
+	if end > total {
+		end = total
+	}
+	return total, revisions[start:end], nil
+}
+
+func (s *MemoryRevisionStore) Revision(resource, recordID string, number int) (*Revision, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	revisions := s.revisions[resource+"/"+recordID]
+	if number < 1 || number > len(revisions) {
+		return nil, ErrRevisionNotFound
+	}
+	rev := revisions[number-1]
+	return &rev, nil
+}
+
+// History is an Interceptor storing a revision of the model after every save
+// of the Edit operation of the services it is registered on.
+type History struct {
+	Store RevisionStore
+
+	mu sync.Mutex
+}
+
+// NewHistory creates a History writing to store.
+func NewHistory(store RevisionStore) *History {
+	return &History{Store: store}
+}
+
+// Intercept snapshots the record after the fetch stage and stores the
+// revisions after the save stage of Edit.
+func (h *History) Intercept(s *State, stage string, next func() error) error {
+	if s.Operation != OperationEdit {
+		return next()
+	}
+
+	if err := next(); err != nil {
+		return err
+	}
+
+	switch stage {
+	case StageFetch:
+		if s.Before == nil {
+			before, err := toJSONValue(s.Model)
+			if err != nil {
+				return NewStageError(http.StatusInternalServerError, err, fmt.Sprintf("cannot encode %s", s.Service.Name))
+			}
+			s.Before = before
+		}
+	case StageSave:
+		if err := h.record(s); err != nil {
+			return NewStageError(http.StatusInternalServerError, err, fmt.Sprintf("cannot store revision of %s", s.Service.Name))
+		}
+	}
+	return nil
+}
+
+// record stores the saved model, preceded by the record as it was before
+// when it has no revisions yet.
+func (h *History) record(s *State) error {
+	after, err := toJSONValue(s.Model)
+	if err != nil {
+		return err
+	}
+
+	revision := Revision{Resource: s.Service.Name, RecordID: s.ID, Snapshot: after, Time: time.Now().UTC()}
+	if principal := GetPrincipal(s.Context); principal != nil {
+		revision.PrincipalID = principal.ID
+	}
+	revision.RevertOf, _ = s.Context.Get(revertKey).(int)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	total, _, err := h.Store.Revisions(revision.Resource, revision.RecordID, 1, 1)
+	if err != nil {
+		return err
+	}
+
+	if total == 0 && s.Before != nil {
+		initial := Revision{Resource: revision.Resource, RecordID: revision.RecordID, Snapshot: s.Before, Time: revision.Time}
+		if err := h.Store.AddRevision(&initial); err != nil {
+			return err
+		}
+	}
+	return h.Store.AddRevision(&revision)
+}
+
+// revisionContext binds a revision snapshot instead of the request body.
+type revisionContext struct {
+	Context
+	snapshot []byte
+}
+
+func (c revisionContext) Bind(i interface{}) error {
+	return json.Unmarshal(c.snapshot, i)
+}
+
+// Register enables the history of service and adds its routes:
+//
+//	GET  /history/:id              revisions of a record, newest first, paginated
+//	GET  /history/:id/:rev         one revision
+//	POST /history/:id/:rev/revert  restores a revision
+//
+// The history endpoints are guarded by security, or when it is empty by the
+// Security the ResourceConfig of the service gives OperationHistory. Revert runs the Edit
+// operation of the request returned by update, with its security, hooks,
+// interceptors and validation, binding the snapshot of the revision instead
+// of the request body; it stores a new revision.
+func (h *History) Register(service *APIService, security Security, update func(c Context) UpdateServiceRequest) {
+	service.Use(h)
+	mux := service.mux()
+
+	history := func(c Context, respond func(s *State) error) error {
+		state := &State{Operation: OperationHistory, Service: service, Context: c, Security: service.securityFor(OperationHistory, security), Model: update(c).Model, ID: c.Param("id")}
+		return service.run(state, []Stage{
+			authenticateStage(),
+			authorizeStage(),
+			parentStage(),
+			fetchStage(),
+			{Name: StageRespond, Run: respond},
+		}, nil)
+	}
+
+	mux.Handle(http.MethodGet, "/history/:id", func(c Context) error {
+		return history(c, func(s *State) error {
+			pagination, err := SetPagination(c)
+			if err != nil {
+				return NewStageError(http.StatusBadRequest, err, "invalid pagination")
+			}
+
+			total, revisions, err := h.Store.Revisions(service.Name, s.ID, pagination.Limit, pagination.Page)
+			if err != nil {
+				return NewStageError(http.StatusInternalServerError, err, "cannot load revisions")
+			}
+
+			for i := range revisions {
+				if revisions[i].Snapshot, err = service.renderValue(c, revisions[i].Snapshot, s.Model, nil, nil); err != nil {
+					return NewStageError(http.StatusInternalServerError, err, fmt.Sprintf("cannot encode %s", service.Name))
+				}
+			}
+
+			totalPages := 1
+			if pagination.Limit > 0 {
+				totalPages = (total + pagination.Limit - 1) / pagination.Limit
+			}
+			return SuccessResponse(c, http.StatusOK, "successfully loaded revisions", echo.Map{"revisions": revisions}, MetaData{
+				Limit:       pagination.Limit,
+				TotalCounts: total,
+				TotalPages:  totalPages,
+				CurrentPage: pagination.Page,
+			})
+		})
+	})
+
+	mux.Handle(http.MethodGet, "/history/:id/:rev", func(c Context) error {
+		return history(c, func(s *State) error {
+			revision, err := h.lookup(service.Name, s.ID, c.Param("rev"))
+			if err != nil {
+				return err
+			}
+
+			if revision.Snapshot, err = service.renderValue(c, revision.Snapshot, s.Model, nil, nil); err != nil {
+				return NewStageError(http.StatusInternalServerError, err, fmt.Sprintf("cannot encode %s", service.Name))
+			}
+			return SuccessResponse(c, http.StatusOK, "successfully loaded revision", echo.Map{"revision": revision}, MetaData{})
+		})
+	})
+
+	mux.Handle(http.MethodPost, "/history/:id/:rev/revert", func(c Context) error {
+		request := update(c)
+		request.Context = c
+		request.Interceptors = append(request.Interceptors, Before(StageBind, func(s *State) error {
+			revision, err := h.lookup(service.Name, s.ID, c.Param("rev"))
+			if err != nil {
+				return err
+			}
+
+			snapshot, err := json.Marshal(revision.Snapshot)
+			if err != nil {
+				return NewStageError(http.StatusInternalServerError, err, fmt.Sprintf("cannot encode %s", service.Name))
+			}
+
+			s.Context.Set(revertKey, revision.Number)
+			s.Context = revisionContext{Context: s.Context, snapshot: snapshot}
+			return nil
+		}))
+		return request.Edit(*service)
+	})
+}
+
+func (h *History) lookup(resource, recordID, rev string) (*Revision, error) {
+	number, err := strconv.Atoi(rev)
+	if err != nil {
+		return nil, NewStageError(http.StatusBadRequest, err, "invalid revision")
+	}
+
+	revision, err := h.Store.Revision(resource, recordID, number)
+	if err != nil {
+		if errors.Is(err, ErrRevisionNotFound) {
+			return nil, NewStageError(http.StatusNotFound, err, "revision not found")
+		}
+		return nil, NewStageError(http.StatusInternalServerError, err, "cannot load revision")
+	}
+	return revision, nil
+}
@@ -0,0 +1,154 @@
+package apimaker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// errHookResponded is returned by HookContext.Respond.
+var errHookResponded = errors.New("hook responded")
+
+// HookFunc is a hook given the context of the request.
+type HookFunc func(h *HookContext) error
+
+// HookContext describes the request a hook runs for.
+type HookContext struct {
+	// Context is the request context, an echo.Context on echo routes.
+	Context   Context
+	Operation Operation
+	Resource  string
+	// Principal is nil for anonymous requests.
+	Principal *Principal
+	// Model is the record as it is being saved, listed, found or removed,
+	// and Old a copy of it from before Edit changed it. Old is the removed
+	// record in Delete and nil in the other operations.
+	Model  Model
+	Old    Model
+	Params []Params
+
+	state *State
+}
+
+func newHookContext(s *State, params []Params) *HookContext {
+	h := &HookContext{
+		Context:   s.Context,
+		Operation: s.Operation,
+		Resource:  s.Service.Name,
+		Principal: GetPrincipal(s.Context),
+		Model:     s.Model,
+		Old:       s.old,
+		Params:    params,
+		state:     s,
+	}
+	if s.Operation == OperationDelete && s.fetch() == nil {
+		h.Old = s.Model
+	}
+	return h
+}
+
+// Param returns the value of the named parameter of the hook.
+func (h *HookContext) Param(key string) (interface{}, bool) {
+	for _, param := range h.Params {
+		if param.Key == key {
+			return param.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Abort stops the operation with an error response of the given status. Like
+// ErrorResponse, the message of err is sent when it is not nil and message
+// otherwise.
+func (h *HookContext) Abort(status int, err error, message string) error {
+	return NewStageError(status, err, message)
+}
+
+// Respond replaces the response of the operation with body, sent as JSON with
+// the given status. Hooks running before the change, such as before_save,
+// stop the operation; later hooks let it publish its event first. The hook
+// returns the result of Respond.
+func (h *HookContext) Respond(status int, body interface{}) error {
+	h.state.response = func(s *State) error {
+		return s.Context.JSON(status, body)
+	}
+	return errHookResponded
+}
+
+// Provide registers dependencies for the hooks of the resource, looked up by
+// type with Dependency.
+func (r *ResourceConfig) Provide(dependencies ...interface{}) *ResourceConfig {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.dependencies == nil {
+		r.dependencies = map[reflect.Type]interface{}{}
+	}
+	for _, dependency := range dependencies {
+		if dependency == nil {
+			continue
+		}
+		r.dependencies[reflect.TypeOf(dependency)] = dependency
+	}
+	return r
+}
+
+func (r *ResourceConfig) dependency(t reflect.Type) (interface{}, bool) {
+	if r == nil {
+		return nil, false
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if dependency, ok := r.dependencies[t]; ok {
+		return dependency, true
+	}
+	if t.Kind() == reflect.Interface {
+		for dependencyType, dependency := range r.dependencies {
+			if dependencyType.Implements(t) {
+				return dependency, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// Dependency returns the dependency of type T provided to the ResourceConfig
+// of the resource; T may be an interface the dependency implements.
+func Dependency[T any](h *HookContext) (T, bool) {
+	var zero T
+	dependency, ok := h.state.Service.config.dependency(reflect.TypeOf((*T)(nil)).Elem())
+	if !ok {
+		return zero, false
+	}
+	return dependency.(T), true
+}
+
+// cloneModel deep copies a model with its Clone method when it has one, and
+// otherwise by decoding its JSON into a new model, from NewModel or of the
+// type of the model, so slices and maps are not shared with the copy.
+func (a APIService) cloneModel(model Model) (Model, error) {
+	if cloner, ok := model.(interface{ Clone() Model }); ok {
+		return cloner.Clone(), nil
+	}
+
+	var clone Model
+	if a.NewModel != nil {
+		clone = a.NewModel()
+	} else {
+		v := reflect.ValueOf(model)
+		if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+			return nil, fmt.Errorf("cannot copy %T", model)
+		}
+		clone = reflect.New(v.Elem().Type()).Interface().(Model)
+	}
+
+	data, err := json.Marshal(model)
+	if err != nil {
+		return nil, fmt.Errorf("cannot copy %T: %w", model, err)
+	}
+	if err := json.Unmarshal(data, clone); err != nil {
+		return nil, fmt.Errorf("cannot copy %T: %w", model, err)
+	}
+	return clone, nil
+}
@@ -0,0 +1,52 @@
+package apimaker
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestHookOldIsDeepCopy(t *testing.T) {
+	mux := http.NewServeMux()
+	store := newTestStore()
+	service := newTestService(mux, "item", store)
+
+	var old *testItem
+	service.Configure().WithHooks(Hooks{BeforeSave: CreateFunc{Hook: func(h *HookContext) error {
+		model := h.Model.(*testItem)
+		model.Tags[0] = "changed"
+		model.Meta["color"] = "changed"
+		old = h.Old.(*testItem)
+		return nil
+	}}})
+	if err := UpdateApi(*service, store.model(), new(testItemForm)); err != nil {
+		t.Fatal(err)
+	}
+
+	item := store.model()
+	item.Tags = []string{"red"}
+	item.Meta = map[string]string{"color": "red"}
+	if err := item.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	if w := serve(mux, http.MethodPut, "/item/update/1", `{"title":"a"}`, nil); w.Code != http.StatusOK {
+		t.Fatalf("edit = %d: %s", w.Code, w.Body)
+	}
+	if old == nil || old.Tags[0] != "red" || old.Meta["color"] != "red" {
+		t.Errorf("old item = %+v, want the tags and meta from before the hook", old)
+	}
+}
+
+func TestRecordCloneIsDeepCopy(t *testing.T) {
+	record := &Record{values: map[string]interface{}{
+		"tags": []interface{}{"red"},
+		"meta": map[string]interface{}{"color": "red"},
+	}}
+	clone := record.Clone().(*Record)
+
+	record.values["tags"].([]interface{})[0] = "changed"
+	record.values["meta"].(map[string]interface{})["color"] = "changed"
+	if clone.values["tags"].([]interface{})[0] != "red" || clone.values["meta"].(map[string]interface{})["color"] != "red" {
+		t.Errorf("clone = %v, want the values from before the change", clone.values)
+	}
+}
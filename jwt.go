@@ -0,0 +1,355 @@
+package apimaker
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JWTConfig configures JWTAuthenticator. The verification key is looked up
+// by the kid header of the token in Keys and then JWKS, falling back to Key.
+type JWTConfig struct {
+	// Key verifies tokens without a known kid: a []byte secret for HS256, an
+	// *rsa.PublicKey for RS256 or an *ecdsa.PublicKey for ES256.
+	Key  interface{}
+	Keys map[string]interface{}
+	JWKS *JWKS
+	// Algorithms accepted, HS256, RS256 and ES256 by default.
+	Algorithms []string
+	// Issuer and Audience, when set, must match the iss and aud claims.
+	Issuer   string
+	Audience []string
+	// RequireExpiration rejects tokens without an exp claim.
+	RequireExpiration bool
+	// Leeway tolerates clock skew when checking exp and nbf.
+	Leeway time.Duration
+	// Cookie is the name of a cookie holding the token when the request has
+	// no Authorization header.
+	Cookie string
+	// RolesClaim names the claim holding the roles of the principal, either
+	// a list or a space separated string; "roles" by default.
+	RolesClaim string
+}
+
+// JWTAuthenticator returns an authenticator validating the bearer token of
+// the request. The principal it stores has the sub claim as ID, the roles of
+// RolesClaim and all the claims in Claims.
+func JWTAuthenticator(config JWTConfig) func(c Context) (bool, error) {
+	algorithms := config.Algorithms
+	if len(algorithms) == 0 {
+		algorithms = []string{"HS256", "RS256", "ES256"}
+	}
+
+	options := []jwt.ParserOption{jwt.WithValidMethods(algorithms), jwt.WithLeeway(config.Leeway)}
+	if config.Issuer != "" {
+		options = append(options, jwt.WithIssuer(config.Issuer))
+	}
+	if len(config.Audience) > 0 {
+		options = append(options, jwt.WithAudience(config.Audience...))
+	}
+	if config.RequireExpiration {
+		options = append(options, jwt.WithExpirationRequired())
+	}
+	parser := jwt.NewParser(options...)
+
+	rolesClaim := config.RolesClaim
+	if rolesClaim == "" {
+		rolesClaim = "roles"
+	}
+
+	return func(c Context) (bool, error) {
+		raw := bearerToken(c.Request(), config.Cookie)
+		if raw == "" {
+			return false, errors.New("missing token")
+		}
+
+		claims := jwt.MapClaims{}
+		if _, err := parser.ParseWithClaims(raw, claims, config.key); err != nil {
+			return false, err
+		}
+
+		principal := &Principal{Roles: claimStrings(claims[rolesClaim]), Claims: claims}
+		principal.ID, _ = claims["sub"].(string)
+		SetPrincipal(c, principal)
+		return true, nil
+	}
+}
+
+// key returns the verification key of a token.
+func (config JWTConfig) key(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid != "" {
+		if key, ok := config.Keys[kid]; ok {
+			return key, nil
+		}
+		if config.JWKS != nil {
+			return config.JWKS.Key(kid)
+		}
+	}
+
+	if config.Key == nil {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+	return config.Key, nil
+}
+
+// bearerToken reads the token of the Authorization header, or of the cookie.
+func bearerToken(r *http.Request, cookie string) string {
+	if header := r.Header.Get("Authorization"); header != "" {
+		scheme, token, found := strings.Cut(header, " ")
+		if found && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+		return ""
+	}
+
+	if cookie != "" {
+		if value, err := r.Cookie(cookie); err == nil {
+			return value.Value
+		}
+	}
+	return ""
+}
+
+// claimStrings reads a claim holding a list of strings or a space separated string.
+func claimStrings(claim interface{}) []string {
+	switch claim := claim.(type) {
+	case string:
+		return strings.Fields(claim)
+	case []interface{}:
+		values := make([]string, 0, len(claim))
+		for _, value := range claim {
+			if s, ok := value.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	case []string:
+		return claim
+	}
+	return nil
+}
+
+// JWKS is a JSON Web Key Set loaded from a URL or a file. Keys are cached for
+// TTL and reloaded early when a token names an unknown kid. Reloads, failed
+// or not, happen at most once per MinRefresh and one at a time; the cached
+// keys stay in use while the source is unavailable.
+type JWKS struct {
+	URL    string
+	File   string
+	Client *http.Client
+	// TTL defaults to one hour and MinRefresh to one minute.
+	TTL        time.Duration
+	MinRefresh time.Duration
+
+	mu      sync.Mutex
+	keys    map[string]interface{}
+	fetched time.Time
+	// attempted is the time of the last reload and err its error; refreshing
+	// is closed when the reload in progress is done.
+	attempted  time.Time
+	err        error
+	refreshing chan struct{}
+}
+
+// NewJWKS loads keys from url.
+func NewJWKS(url string) *JWKS {
+	return &JWKS{URL: url, Client: &http.Client{Timeout: 10 * time.Second}, TTL: time.Hour, MinRefresh: time.Minute}
+}
+
+// NewJWKSFile loads keys from the file at path.
+func NewJWKSFile(path string) *JWKS {
+	return &JWKS{File: path, TTL: time.Hour, MinRefresh: time.Minute}
+}
+
+// Key returns the key with the given kid.
+func (j *JWKS) Key(kid string) (interface{}, error) {
+	ttl, minRefresh := j.TTL, j.MinRefresh
+	if ttl <= 0 {
+		ttl = time.Hour
+	}
+	if minRefresh <= 0 {
+		minRefresh = time.Minute
+	}
+
+	reloaded := false
+	for {
+		j.mu.Lock()
+		key, known := j.keys[kid]
+		// expired keys are reloaded, unknown kids at most once per MinRefresh
+		// and so are failed reloads
+		throttled := time.Since(j.attempted) <= minRefresh
+		due := !known && !throttled
+		if j.keys == nil || time.Since(j.fetched) > ttl {
+			due = j.err == nil || !throttled
+		}
+		// the first keys are waited for even when the last reload failed
+		if j.refreshing != nil && j.keys == nil {
+			due = true
+		}
+		if reloaded || !due {
+			keys, err := j.keys, j.err
+			j.mu.Unlock()
+
+			if keys == nil && err != nil {
+				return nil, err
+			}
+			if !known {
+				return nil, fmt.Errorf("unknown key %q", kid)
+			}
+			return key, nil
+		}
+
+		// wait for the reload in progress instead of starting another
+		if refreshing := j.refreshing; refreshing != nil {
+			j.mu.Unlock()
+			<-refreshing
+			reloaded = true
+			continue
+		}
+
+		refreshing := make(chan struct{})
+		j.refreshing, j.attempted = refreshing, time.Now()
+		j.mu.Unlock()
+
+		keys, err := j.load()
+
+		j.mu.Lock()
+		if err == nil {
+			j.keys, j.fetched = keys, time.Now()
+		}
+		j.err, j.refreshing = err, nil
+		close(refreshing)
+		j.mu.Unlock()
+		reloaded = true
+	}
+}
+
+func (j *JWKS) load() (map[string]interface{}, error) {
+	if j.File != "" {
+		data, err := os.ReadFile(j.File)
+		if err != nil {
+			return nil, err
+		}
+		return ParseJWKS(data)
+	}
+
+	client := j.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Get(j.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("cannot load jwks: %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	return ParseJWKS(data)
+}
+
+// jsonWebKey is the subset of RFC 7517 used for RSA, EC and symmetric keys.
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+// ParseJWKS parses a JSON Web Key Set into keys by kid. Keys not meant for
+// signatures and unsupported key types are skipped.
+func ParseJWKS(data []byte) (map[string]interface{}, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid jwks: %w", err)
+	}
+
+	keys := map[string]interface{}{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		key, err := jwk.key()
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %q: %w", jwk.Kid, err)
+		}
+		if key != nil {
+			keys[jwk.Kid] = key
+		}
+	}
+	return keys, nil
+}
+
+func (jwk jsonWebKey) key() (interface{}, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeBase64URL(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBase64URL(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid exponent")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+	case "EC":
+		curves := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}
+		curve, ok := curves[jwk.Crv]
+		if !ok {
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := decodeBase64URL(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBase64URL(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("point is not on the curve")
+		}
+		return key, nil
+	case "oct":
+		return decodeBase64URL(jwk.K)
+	}
+	return nil, nil
+}
+
+func decodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
@@ -0,0 +1,135 @@
+package apimaker
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestJWTAuthenticator(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := []byte("secret")
+	authenticate := JWTAuthenticator(JWTConfig{
+		Keys:              map[string]interface{}{"hmac": secret, "rsa": &rsaKey.PublicKey},
+		Issuer:            "issuer",
+		RequireExpiration: true,
+	})
+
+	sign := func(method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(method, claims)
+		token.Header["kid"] = kid
+		raw, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return raw
+	}
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{"sub": "alice", "iss": "issuer", "roles": "admin editor", "exp": time.Now().Add(time.Hour).Unix()}
+	}
+	expired := valid()
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+	otherIssuer := valid()
+	otherIssuer["iss"] = "other"
+	unlimited := valid()
+	delete(unlimited, "exp")
+	publicKey, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name  string
+		token string
+		ok    bool
+	}{
+		{"hs256", sign(jwt.SigningMethodHS256, "hmac", secret, valid()), true},
+		{"rs256", sign(jwt.SigningMethodRS256, "rsa", rsaKey, valid()), true},
+		{"expired", sign(jwt.SigningMethodHS256, "hmac", secret, expired), false},
+		{"other issuer", sign(jwt.SigningMethodHS256, "hmac", secret, otherIssuer), false},
+		{"no expiration", sign(jwt.SigningMethodHS256, "hmac", secret, unlimited), false},
+		{"wrong secret", sign(jwt.SigningMethodHS256, "hmac", []byte("other"), valid()), false},
+		{"disallowed alg", sign(jwt.SigningMethodHS512, "hmac", secret, valid()), false},
+		{"alg none", sign(jwt.SigningMethodNone, "hmac", jwt.UnsafeAllowNoneSignatureType, valid()), false},
+		// an HMAC token keyed with the public key of an RSA kid
+		{"alg confusion", sign(jwt.SigningMethodHS256, "rsa", publicKey, valid()), false},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Authorization", "Bearer "+test.token)
+		c := NewHTTPContext(httptest.NewRecorder(), r, nil, nil)
+
+		ok, err := authenticate(c)
+		if ok != test.ok || (err == nil) != test.ok {
+			t.Errorf("%s: authenticated = %v, %v, want %v", test.name, ok, err, test.ok)
+			continue
+		}
+		if principal := GetPrincipal(c); test.ok && (principal == nil || principal.ID != "alice" || !principal.HasRole("editor")) {
+			t.Errorf("%s: principal = %+v", test.name, principal)
+		}
+	}
+}
+
+func TestJWKSRefreshesOnceWhileTheSourceIsDown(t *testing.T) {
+	var mu sync.Mutex
+	requests, down := 0, false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		failing := down
+		mu.Unlock()
+
+		// slow enough for concurrent lookups to overlap the reload
+		time.Sleep(20 * time.Millisecond)
+		if failing {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"keys":[{"kty":"oct","kid":"a","k":"c2VjcmV0"}]}`))
+	}))
+	defer server.Close()
+
+	jwks := NewJWKS(server.URL)
+	jwks.TTL, jwks.MinRefresh = time.Millisecond, time.Hour
+	lookup := func() {
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := jwks.Key("a"); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+	}
+
+	lookup()
+	mu.Lock()
+	if requests != 1 {
+		t.Errorf("first lookups made %d requests, want 1", requests)
+	}
+	down = true
+	mu.Unlock()
+
+	// past the TTL, the failed reload keeps the cached key and is not retried
+	// before MinRefresh
+	time.Sleep(5 * time.Millisecond)
+	lookup()
+	lookup()
+	mu.Lock()
+	defer mu.Unlock()
+	if requests != 2 {
+		t.Errorf("lookups while the source is down made %d requests, want 1", requests-1)
+	}
+}
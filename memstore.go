@@ -0,0 +1,266 @@
+package apimaker
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrRecordNotFound is returned by declarative resources for unknown ids.
+var ErrRecordNotFound = errors.New("record not found")
+
+// MemoryStore is a concurrency safe in-memory table of records, each a
+// generic JSON object keyed by its "id". It backs declarative resources and
+// is handy for prototypes and tests.
+type MemoryStore struct {
+	// Outbox receives the events appended in transactions.
+	Outbox *MemoryOutbox
+
+	mu      sync.RWMutex
+	txMu    sync.Mutex
+	records map[string]map[string]interface{}
+	nextID  int
+	// versions counts the writes of every id, so that a rollback can tell
+	// whether a record was written since the transaction did.
+	versions map[string]int
+}
+
+// NewMemoryStore creates an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: map[string]map[string]interface{}{}, versions: map[string]int{}}
+}
+
+// Save stores a copy of values and returns its id, assigning a new one when
+// values has none.
+func (s *MemoryStore) Save(values map[string]interface{}) string {
+	id, _, _ := s.save(values)
+	return id
+}
+
+// save stores values and returns its id, the record it replaced and the
+// version of the write.
+func (s *MemoryStore) save(values map[string]interface{}) (string, map[string]interface{}, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := fmt.Sprint(values["id"])
+	if values["id"] == nil || id == "" {
+		s.nextID++
+		id = strconv.Itoa(s.nextID)
+	}
+
+	record := copyValues(values)
+	record["id"] = id
+	before := s.records[id]
+	s.records[id] = record
+	s.versions[id]++
+	return id, before, s.versions[id]
+}
+
+// Get returns a copy of the record with the given id.
+func (s *MemoryStore) Get(id string) (map[string]interface{}, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	record, ok := s.records[id]
+	if !ok {
+		return nil, false
+	}
+	return copyValues(record), true
+}
+
+// Delete removes the record with the given id and reports whether it existed.
+func (s *MemoryStore) Delete(id string) bool {
+	_, _, ok := s.delete(id)
+	return ok
+}
+
+// delete removes the record with the given id and returns it and the
+// version of the write.
+func (s *MemoryStore) delete(id string) (map[string]interface{}, int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.records[id]
+	if !ok {
+		return nil, 0, false
+	}
+	delete(s.records, id)
+	s.versions[id]++
+	return record, s.versions[id], true
+}
+
+// List returns one page of the records whose fields equal the filters,
+// ordered by sortField ("name" ascending, "-name" descending, id by default).
+// A limit below one returns every record.
+func (s *MemoryStore) List(filters map[string]interface{}, sortField string, limit, page int) (int, int, []map[string]interface{}) {
+	s.mu.RLock()
+	list := []map[string]interface{}{}
+	for _, record := range s.records {
+		if matchesFilters(record, filters) {
+			list = append(list, copyValues(record))
+		}
+	}
+	s.mu.RUnlock()
+
+	descending := strings.HasPrefix(sortField, "-")
+	sortField = strings.TrimPrefix(sortField, "-")
+	sort.SliceStable(list, func(i, j int) bool {
+		if sortField == "" {
+			return compareValues(list[i]["id"], list[j]["id"]) < 0
+		}
+		cmp := compareValues(list[i][sortField], list[j][sortField])
+		if descending {
+			return cmp > 0
+		}
+		return cmp < 0
+	})
+
+	totalCounts := len(list)
+	if limit < 1 {
+		return totalCounts, 1, list
+	}
+
+	if page < 1 {
+		page = 1
+	}
+
+	totalPages := (totalCounts + limit - 1) / limit
+	start := (page - 1) * limit
+	if start > totalCounts {
+		start = totalCounts
+	}
+	end := start + limit
+	if end > totalCounts {
+		end = totalCounts
+	}
+	return totalCounts, totalPages, list[start:end]
+}
+
+// Transaction runs fn and adds the events it appends to Outbox once it
+// succeeded. When fn fails the records it saved and deleted through tx are
+// restored as they were before, so the store and its outbox change together
+// or not at all; writes made outside of tx, and records written again since,
+// are kept. Transactions run one at a time.
+func (s *MemoryStore) Transaction(fn func(tx *MemoryTx) error) error {
+	if s.Outbox == nil {
+		return errors.New("memory store has no outbox")
+	}
+
+	s.txMu.Lock()
+	defer s.txMu.Unlock()
+
+	tx := &MemoryTx{store: s, undo: map[string]memoryUndo{}}
+	if err := fn(tx); err != nil {
+		tx.rollback()
+		return err
+	}
+
+	s.Outbox.add(tx.events...)
+	return nil
+}
+
+// MemoryTx is a transaction of a MemoryStore. It is the OutboxWriter of the
+// transaction and records the writes to undo when it fails.
+type MemoryTx struct {
+	store  *MemoryStore
+	events []Event
+	undo   map[string]memoryUndo
+}
+
+// memoryUndo is the record an id had before its first write in a
+// transaction, and the version of the last write of the transaction.
+type memoryUndo struct {
+	before  map[string]interface{}
+	version int
+}
+
+// Save stores values like MemoryStore.Save, within the transaction.
+func (tx *MemoryTx) Save(values map[string]interface{}) string {
+	id, before, version := tx.store.save(values)
+	tx.written(id, before, version)
+	return id
+}
+
+// Delete removes a record like MemoryStore.Delete, within the transaction.
+func (tx *MemoryTx) Delete(id string) bool {
+	before, version, ok := tx.store.delete(id)
+	if ok {
+		tx.written(id, before, version)
+	}
+	return ok
+}
+
+// Append buffers e until the transaction succeeds.
+func (tx *MemoryTx) Append(e Event) error {
+	tx.events = append(tx.events, e)
+	return nil
+}
+
+func (tx *MemoryTx) written(id string, before map[string]interface{}, version int) {
+	undo, ok := tx.undo[id]
+	if !ok {
+		undo.before = before
+	}
+	undo.version = version
+	tx.undo[id] = undo
+}
+
+// rollback restores the records written in the transaction, unless they
+// were written again outside of it.
+func (tx *MemoryTx) rollback() {
+	s := tx.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, undo := range tx.undo {
+		if s.versions[id] != undo.version {
+			continue
+		}
+		if undo.before == nil {
+			delete(s.records, id)
+		} else {
+			s.records[id] = undo.before
+		}
+		s.versions[id]++
+	}
+}
+
+// matchesFilters reports whether every filter equals the record field of the
+// same name, comparing their string forms.
+func matchesFilters(record map[string]interface{}, filters map[string]interface{}) bool {
+	for key, want := range filters {
+		if fmt.Sprint(record[key]) != fmt.Sprint(want) {
+			return false
+		}
+	}
+	return true
+}
+
+// compareValues orders generic JSON values: numbers numerically, everything
+// else by its string form.
+func compareValues(a, b interface{}) int {
+	x, errA := strconv.ParseFloat(fmt.Sprint(a), 64)
+	y, errB := strconv.ParseFloat(fmt.Sprint(b), 64)
+	if errA == nil && errB == nil {
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(fmt.Sprint(a), fmt.Sprint(b))
+}
+
+func copyValues(values map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(values))
+	for key, value := range values {
+		out[key] = value
+	}
+	return out
+}
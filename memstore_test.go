@@ -0,0 +1,47 @@
+package apimaker
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMemoryStoreRollbackKeepsWritesOutsideTheTransaction(t *testing.T) {
+	store := NewMemoryStore()
+	store.Outbox = NewMemoryOutbox()
+	store.Save(map[string]interface{}{"id": "kept", "name": "before"})
+	store.Save(map[string]interface{}{"id": "removed", "name": "before"})
+
+	failed := errors.New("failed")
+	err := store.Transaction(func(tx *MemoryTx) error {
+		tx.Save(map[string]interface{}{"id": "kept", "name": "in transaction"})
+		tx.Delete("removed")
+		tx.Save(map[string]interface{}{"id": "created"})
+		if err := tx.Append(Event{ID: "e"}); err != nil {
+			return err
+		}
+
+		// concurrent writes, one of them to a record of the transaction
+		store.Save(map[string]interface{}{"id": "outside"})
+		store.Save(map[string]interface{}{"id": "created", "name": "outside"})
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("transaction = %v, want its error", err)
+	}
+
+	if record, _ := store.Get("kept"); record["name"] != "before" {
+		t.Errorf("saved record = %v, want it restored", record)
+	}
+	if _, ok := store.Get("removed"); !ok {
+		t.Error("deleted record not restored")
+	}
+	if _, ok := store.Get("outside"); !ok {
+		t.Error("write outside the transaction lost")
+	}
+	if record, _ := store.Get("created"); record["name"] != "outside" {
+		t.Errorf("record written again outside the transaction = %v, want it kept", record)
+	}
+	if store.Outbox.Len() != 0 {
+		t.Errorf("outbox has %d events of a failed transaction", store.Outbox.Len())
+	}
+}
@@ -1,6 +1,8 @@
 package apimaker
 
 import (
+	"fmt"
+
 	"github.com/labstack/echo/v4"
 )
 
@@ -8,6 +10,8 @@ type Model interface {
 	Save() error
 	GetOne(id interface{}) error
 	//filter for filter, page filtering - totalCounts, totalPages, list , error
+	// The filter is a ConstrainedFilter when parents, tenancy or record rules
+	// scope the list; UnwrapFilter returns the filter bound from the request.
 	List(filter Filter, pfilter Pagination) (int, int, interface{}, error)
 	Remove(id interface{}) error
 }
@@ -19,12 +23,47 @@ type Params struct {
 	Value interface{}
 }
 
+// CreateFunc is a hook. Hook, when set, is run instead of Function and is
+// given a HookContext describing the request.
 type CreateFunc struct {
 	Function func(model Model, params ...Params) error
+	Hook     HookFunc
 	Params   []Params
 }
 
+// set reports whether the hook has a function to run.
+func (f CreateFunc) set() bool {
+	return f.Function != nil || f.Hook != nil
+}
+
+// Security guards an operation. The Authenticator and Authorizer take the
+// router-neutral Context; they took an echo.Context before services could be
+// registered on other routers, and existing ones are wrapped with EchoCheck.
 type Security struct {
-	Authenticator func(c echo.Context) (bool, error)
-	Authorizer    func(c echo.Context) (bool, error)
+	Authenticator func(c Context) (bool, error)
+	Authorizer    func(c Context) (bool, error)
+	// Policy, when set, also has to authorize the operation; unlike
+	// Authorizer it is told the resource and operation.
+	Policy Policy
+}
+
+// set reports whether the Security checks anything.
+func (s Security) set() bool {
+	return s.Authenticator != nil || s.Authorizer != nil || s.Policy != nil
+}
+
+// EchoCheck adapts an Authenticator or Authorizer taking an echo.Context, as
+// they did before the pipelines supported other routers:
+//
+//	Security{Authenticator: apimaker.EchoCheck(authenticate)}
+//
+// The check fails on routes not registered on echo.
+func EchoCheck(check func(c echo.Context) (bool, error)) func(c Context) (bool, error) {
+	return func(c Context) (bool, error) {
+		ec, ok := c.(echo.Context)
+		if !ok {
+			return false, fmt.Errorf("%T is not an echo context", c)
+		}
+		return check(ec)
+	}
 }
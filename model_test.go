@@ -0,0 +1,24 @@
+package apimaker
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestEchoCheck(t *testing.T) {
+	check := EchoCheck(func(c echo.Context) (bool, error) {
+		return c.Request().Header.Get("X-User") != "", nil
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-User", "alice")
+	if ok, err := check(echo.New().NewContext(r, httptest.NewRecorder())); !ok || err != nil {
+		t.Errorf("echo context = %v, %v, want true", ok, err)
+	}
+	if ok, err := check(NewHTTPContext(httptest.NewRecorder(), r, nil, nil)); ok || err == nil {
+		t.Errorf("net/http context = %v, %v, want an error", ok, err)
+	}
+}
@@ -0,0 +1,90 @@
+package apimaker
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Mux registers handlers on a router. Paths use the echo syntax, as in
+// "/view/:id", and are translated by each adapter. Handle returns the full
+// path of the route in the same syntax, which is recorded to document the API.
+type Mux interface {
+	Handle(method, path string, h HandlerFunc) string
+	Group(prefix string) Mux
+}
+
+// mux returns the router the service registers its routes on.
+func (a *APIService) mux() Mux {
+	if a.Mux != nil {
+		return a.Mux
+	}
+	return EchoMux(a.Group)
+}
+
+// PathPattern converts an echo style path into the {name} syntax of
+// net/http and chi and returns the names of its parameters.
+func PathPattern(path string) (string, []string) {
+	var params []string
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			params = append(params, segment[1:])
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/"), params
+}
+
+// echoMux registers routes on an echo group; echo.Context is passed to the
+// handlers unchanged.
+type echoMux struct {
+	group *echo.Group
+}
+
+// EchoMux adapts an echo group.
+func EchoMux(g *echo.Group) Mux {
+	return echoMux{group: g}
+}
+
+func (m echoMux) Handle(method, path string, h HandlerFunc) string {
+	route := m.group.Add(method, path, func(c echo.Context) error {
+		return h(c)
+	})
+	return route.Path
+}
+
+func (m echoMux) Group(prefix string) Mux {
+	return echoMux{group: m.group.Group(prefix)}
+}
+
+// httpMux registers routes on a Go 1.22 http.ServeMux.
+type httpMux struct {
+	mux       *http.ServeMux
+	prefix    string
+	validator echo.Validator
+}
+
+// HTTPMux adapts a http.ServeMux. Routes are registered below prefix and
+// requests are validated with validator.
+func HTTPMux(mux *http.ServeMux, prefix string, validator echo.Validator) Mux {
+	return httpMux{mux: mux, prefix: strings.TrimSuffix(prefix, "/"), validator: validator}
+}
+
+func (m httpMux) Handle(method, path string, h HandlerFunc) string {
+	full := m.prefix + path
+	pattern, names := PathPattern(full)
+	m.mux.HandleFunc(method+" "+pattern, func(w http.ResponseWriter, r *http.Request) {
+		params := make(map[string]string, len(names))
+		for _, name := range names {
+			params[name] = r.PathValue(name)
+		}
+		ServeHTTPContext(NewHTTPContext(w, r, params, m.validator), h)
+	})
+	return full
+}
+
+func (m httpMux) Group(prefix string) Mux {
+	return httpMux{mux: m.mux, prefix: m.prefix + prefix, validator: m.validator}
+}
@@ -0,0 +1,107 @@
+package apimaker
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrParentMismatch is returned when a record does not belong to the parent
+// resource addressed by the route.
+var ErrParentMismatch = errors.New("record not found")
+
+// ParentScope links a nested resource to the resource it lives under, as in
+// /stores/:storeId/products.
+type ParentScope struct {
+	// Service is the parent resource; its NewModel is used to validate the parent id.
+	Service *APIService
+	// Param is the route parameter holding the parent id, e.g. "storeId".
+	Param string
+	// ForeignKey is the json name of the child field referencing the parent, e.g. "store_id".
+	ForeignKey string
+}
+
+// Nest creates a child resource registered under /:param/name of this
+// service's routes. The child shares the validator and logger of its parent;
+// every operation on it checks that the parent exists, List only returns
+// records of the parent, Create stamps the parent id on the model and
+// View, Edit and Delete answer 404 for records of another parent.
+func (a *APIService) Nest(name, param, foreignKey string) *APIService {
+	prefix := "/:" + param + "/" + name
+
+	var child *APIService
+	if a.Group != nil {
+		child = NewAPIService(name, a.Group.Group(prefix), a.Validator, a.Logger)
+	} else {
+		child = NewAPIServiceWithMux(name, a.mux().Group(prefix), a.Validator, a.Logger)
+	}
+	child.Parent = &ParentScope{
+		Service:    a,
+		Param:      param,
+		ForeignKey: foreignKey,
+	}
+	return child
+}
+
+// loadParent validates the parent ids of the route, from the outermost parent
+// inwards, and returns the id of the direct parent.
+func (a *APIService) loadParent(c Context) (string, error) {
+	if a.Parent == nil {
+		return "", nil
+	}
+
+	parentService := a.Parent.Service
+	grandparentID, err := parentService.loadParent(c)
+	if err != nil {
+		return "", err
+	}
+
+	if parentService.NewModel == nil {
+		return "", fmt.Errorf("parent resource %s has no model", parentService.Name)
+	}
+
+	id := c.Param(a.Parent.Param)
+	parent := parentService.NewModel()
+	if err := parent.GetOne(id); err != nil {
+		return "", fmt.Errorf("cannot find any %s", parentService.Name)
+	}
+
+	if err := parentService.checkParent(parent, grandparentID); err != nil {
+		return "", fmt.Errorf("cannot find any %s", parentService.Name)
+	}
+	return id, nil
+}
+
+// checkParent returns ErrParentMismatch when the model does not reference the
+// given parent id.
+func (a *APIService) checkParent(model Model, parentID string) error {
+	if a.Parent == nil {
+		return nil
+	}
+
+	value, err := toJSONValue(model)
+	if err != nil {
+		return err
+	}
+
+	object, ok := value.(map[string]interface{})
+	if !ok || fmt.Sprint(object[a.Parent.ForeignKey]) != parentID {
+		return ErrParentMismatch
+	}
+	return nil
+}
+
+// stampParent sets the parent id on a model that is about to be saved.
+func (a *APIService) stampParent(model Model, parentID string) error {
+	if a.Parent == nil {
+		return nil
+	}
+	return setModelField(model, a.Parent.ForeignKey, parentID)
+}
+
+// scopeFilter restricts a list filter to the records of the parent.
+func (a *APIService) scopeFilter(filter Filter, parentID string) Filter {
+	if a.Parent == nil {
+		return filter
+	}
+	return WithConstraints(filter, map[string]interface{}{a.Parent.ForeignKey: parentID})
+}
@@ -0,0 +1,73 @@
+package apimaker
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestEditKeepsParentOfRoute(t *testing.T) {
+	mux := http.NewServeMux()
+	storeStore, itemStore := newTestStore(), newTestStore()
+	stores := newTestService(mux, "store", storeStore)
+	items := stores.Nest("item", "storeId", "store_id")
+	items.NewModel = func() Model { return itemStore.model() }
+	if err := UpdateApi(*items, itemStore.model(), new(testItemForm)); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := storeStore.model().Save(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	item := itemStore.model()
+	item.StoreID = "1"
+	if err := item.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	w := serve(mux, http.MethodPut, "/store/1/item/update/1", `{"title":"moved","store_id":"2"}`, nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("edit = %d: %s", w.Code, w.Body)
+	}
+
+	saved := itemStore.model()
+	if err := saved.GetOne("1"); err != nil {
+		t.Fatal(err)
+	}
+	if saved.StoreID != "1" || saved.Title != "moved" {
+		t.Errorf("edited item = %+v, want title moved in store 1", saved)
+	}
+}
+
+// unwrappingItem records the filter bound from the request of its lists.
+type unwrappingItem struct {
+	*testItem
+	bound *Filter
+}
+
+func (m *unwrappingItem) List(filter Filter, pagination Pagination) (int, int, interface{}, error) {
+	*m.bound = UnwrapFilter(filter)
+	return m.testItem.List(filter, pagination)
+}
+
+func TestNestedListUnwrapsToBoundFilter(t *testing.T) {
+	mux := http.NewServeMux()
+	storeStore, itemStore := newTestStore(), newTestStore()
+	items := newTestService(mux, "store", storeStore).Nest("item", "storeId", "store_id")
+	if err := storeStore.model().Save(); err != nil {
+		t.Fatal(err)
+	}
+	var bound Filter
+	if err := ListApi(*items, &unwrappingItem{testItem: itemStore.model(), bound: &bound}, new(testItemFilter)); err != nil {
+		t.Fatal(err)
+	}
+
+	w := serve(mux, http.MethodGet, "/store/1/item/list?title=a", "", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("list = %d: %s", w.Code, w.Body)
+	}
+	if filter, ok := bound.(*testItemFilter); !ok || filter.Title != "a" {
+		t.Errorf("unwrapped filter = %#v, want the bound *testItemFilter", bound)
+	}
+}
@@ -0,0 +1,287 @@
+package apimaker
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"html/template"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	// OpenAPIInfo is the info object of an OpenAPI document.
+	OpenAPIInfo struct {
+		Title       string `json:"title"`
+		Version     string `json:"version"`
+		Description string `json:"description,omitempty"`
+	}
+
+	// OpenAPIDocument is an OpenAPI 3.1 document.
+	OpenAPIDocument struct {
+		OpenAPI    string                                  `json:"openapi"`
+		Info       OpenAPIInfo                             `json:"info"`
+		Paths      map[string]map[string]*OpenAPIOperation `json:"paths"`
+		Components OpenAPIComponents                       `json:"components"`
+	}
+
+	// OpenAPIComponents holds the reusable schemas of a document.
+	OpenAPIComponents struct {
+		Schemas map[string]*Schema `json:"schemas"`
+	}
+
+	// OpenAPIOperation describes a single route.
+	OpenAPIOperation struct {
+		OperationID string                     `json:"operationId"`
+		Summary     string                     `json:"summary"`
+		Tags        []string                   `json:"tags"`
+		Parameters  []OpenAPIParameter         `json:"parameters,omitempty"`
+		RequestBody *OpenAPIRequestBody        `json:"requestBody,omitempty"`
+		Responses   map[string]OpenAPIResponse `json:"responses"`
+	}
+
+	// OpenAPIParameter is a path or query parameter.
+	OpenAPIParameter struct {
+		Name        string  `json:"name"`
+		In          string  `json:"in"`
+		Description string  `json:"description,omitempty"`
+		Required    bool    `json:"required,omitempty"`
+		Schema      *Schema `json:"schema"`
+	}
+
+	// OpenAPIRequestBody is the body of a create or edit request.
+	OpenAPIRequestBody struct {
+		Required bool                        `json:"required"`
+		Content  map[string]OpenAPIMediaType `json:"content"`
+	}
+
+	// OpenAPIResponse is a response of an operation.
+	OpenAPIResponse struct {
+		Description string                      `json:"description"`
+		Content     map[string]OpenAPIMediaType `json:"content,omitempty"`
+	}
+
+	// OpenAPIMediaType holds the schema of a request or response body.
+	OpenAPIMediaType struct {
+		Schema *Schema `json:"schema"`
+	}
+
+	// OpenAPIConfig configures ServeOpenAPI.
+	OpenAPIConfig struct {
+		Info OpenAPIInfo
+		// Path serves the JSON document, "/openapi.json" by default.
+		Path string
+		// UIPath serves the Swagger UI, "/docs" by default; "-" disables it.
+		UIPath string
+	}
+)
+
+//go:embed swagger.html
+var swaggerHTML string
+
+var swaggerTemplate = template.Must(template.New("swagger").Parse(swaggerHTML))
+
+// NewOpenAPIDocument builds an OpenAPI 3.1 document from the routes recorded
+// on the given services. Request bodies are reflected from forms, responses
+// wrap models in the Response envelope and query parameters come from
+// Pagination and the filter types.
+func NewOpenAPIDocument(info OpenAPIInfo, services ...*APIService) *OpenAPIDocument {
+	registry := NewSchemaRegistry()
+	doc := &OpenAPIDocument{
+		OpenAPI: "3.1.0",
+		Info:    info,
+		Paths:   map[string]map[string]*OpenAPIOperation{},
+	}
+
+	envelope := registry.Ref(reflect.TypeOf(Response{}))
+	for _, service := range services {
+		for _, route := range service.Routes() {
+			path, params := openAPIPath(route.Path)
+			op := &OpenAPIOperation{
+				OperationID: string(route.Operation) + exportName(service.Name),
+				Summary:     strings.ToUpper(string(route.Operation[:1])) + string(route.Operation[1:]) + " " + service.Name,
+				Tags:        []string{service.Name},
+				Parameters:  params,
+				Responses: map[string]OpenAPIResponse{
+					"default": jsonResponse("error", envelope),
+				},
+			}
+
+			if route.Form != nil {
+				op.RequestBody = &OpenAPIRequestBody{
+					Required: true,
+					Content:  map[string]OpenAPIMediaType{echo.MIMEApplicationJSON: {Schema: registry.Ref(jsonType(route.Form))}},
+				}
+			}
+
+			model := registry.Ref(jsonType(route.Model))
+			data := map[string]*Schema{service.Name: model}
+			switch route.Operation {
+			case OperationList:
+				op.Parameters = append(op.Parameters, queryParameters(registry, reflect.TypeOf(Pagination{}))...)
+				if route.Filter != nil {
+					op.Parameters = append(op.Parameters, queryParameters(registry, jsonType(route.Filter))...)
+				}
+				op.Parameters = append(op.Parameters, renderParameters(service)...)
+				data = map[string]*Schema{
+					service.Name + "s": {Type: "array", Items: model},
+					"total_counts":     {Type: "integer"},
+					"total_pages":      {Type: "integer"},
+				}
+			case OperationView:
+				op.Parameters = append(op.Parameters, renderParameters(service)...)
+			case OperationDelete:
+				data = nil
+			}
+
+			success := envelope
+			if data != nil {
+				success = &Schema{AllOf: []*Schema{envelope, {
+					Type:       "object",
+					Properties: map[string]*Schema{"data": {Type: "object", Properties: data}},
+				}}}
+			}
+			op.Responses["200"] = jsonResponse("successful "+string(route.Operation), success)
+
+			if doc.Paths[path] == nil {
+				doc.Paths[path] = map[string]*OpenAPIOperation{}
+			}
+			doc.Paths[path][strings.ToLower(route.Method)] = op
+		}
+	}
+
+	doc.Components.Schemas = registry.Schemas
+	return doc
+}
+
+// ServeOpenAPI serves the OpenAPI document of the services as JSON and an
+// embedded Swagger UI page on mux, e.g. EchoMux(ec.Group("")) or
+// HTTPMux(mux, "", validator). The document is rebuilt on every request so
+// routes registered later are included.
+func ServeOpenAPI(mux Mux, cfg OpenAPIConfig, services ...*APIService) {
+	if cfg.Path == "" {
+		cfg.Path = "/openapi.json"
+	}
+
+	if cfg.UIPath == "" {
+		cfg.UIPath = "/docs"
+	}
+
+	spec := mux.Handle(http.MethodGet, cfg.Path, func(c Context) error {
+		return c.JSON(http.StatusOK, NewOpenAPIDocument(cfg.Info, services...))
+	})
+
+	if cfg.UIPath == "-" {
+		return
+	}
+
+	var page bytes.Buffer
+	if err := swaggerTemplate.Execute(&page, map[string]string{"Title": cfg.Info.Title, "SpecURL": spec}); err != nil {
+		panic(err)
+	}
+
+	mux.Handle(http.MethodGet, cfg.UIPath, func(c Context) error {
+		w, ok := responseWriter(c)
+		if !ok {
+			return fmt.Errorf("cannot write the page to %T", c)
+		}
+		w.Header().Set(echo.HeaderContentType, echo.MIMETextHTMLCharsetUTF8)
+		w.WriteHeader(http.StatusOK)
+		_, err := w.Write(page.Bytes())
+		return err
+	})
+}
+
+// openAPIPath converts an echo path to OpenAPI syntax and returns its path parameters.
+func openAPIPath(path string) (string, []OpenAPIParameter) {
+	var params []OpenAPIParameter
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			name := segment[1:]
+			segments[i] = "{" + name + "}"
+			params = append(params, OpenAPIParameter{Name: name, In: "path", Required: true, Schema: &Schema{Type: "string"}})
+		}
+	}
+	return strings.Join(segments, "/"), params
+}
+
+// queryParameters reflects the query tagged fields of a struct type the way
+// echo binds them.
+func queryParameters(registry *SchemaRegistry, t reflect.Type) []OpenAPIParameter {
+	t = indirectType(t)
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var params []OpenAPIParameter
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		name := sf.Tag.Get("query")
+		if name == "" {
+			if indirectType(sf.Type).Kind() == reflect.Struct {
+				params = append(params, queryParameters(registry, sf.Type)...)
+			}
+			continue
+		}
+
+		schema := registry.Ref(sf.Type)
+		applyValidateTag(schema, sf.Type, sf.Tag.Get("validate"))
+		params = append(params, OpenAPIParameter{Name: name, In: "query", Schema: schema})
+	}
+	return params
+}
+
+// renderParameters documents the fields and include query parameters.
+func renderParameters(service *APIService) []OpenAPIParameter {
+	params := []OpenAPIParameter{{
+		Name:        "fields",
+		In:          "query",
+		Description: "comma separated json field names, nested fields use dotted paths",
+		Schema:      &Schema{Type: "string"},
+	}}
+
+	if len(service.Relations) > 0 {
+		var names []string
+		for _, relation := range service.Relations {
+			names = append(names, relation.Name)
+		}
+		params = append(params, OpenAPIParameter{
+			Name:        "include",
+			In:          "query",
+			Description: "comma separated related resources to embed: " + strings.Join(names, ", "),
+			Schema:      &Schema{Type: "string"},
+		})
+	}
+	return params
+}
+
+func jsonResponse(description string, schema *Schema) OpenAPIResponse {
+	return OpenAPIResponse{
+		Description: description,
+		Content:     map[string]OpenAPIMediaType{echo.MIMEApplicationJSON: {Schema: schema}},
+	}
+}
+
+// exportName turns a resource name like "product_items" into "ProductItems".
+func exportName(name string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range name {
+		if r == '_' || r == '-' || r == ' ' || r == '/' {
+			upper = true
+			continue
+		}
+
+		if upper {
+			b.WriteString(strings.ToUpper(string(r)))
+			upper = false
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,30 @@
+package apimaker
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestServeOpenAPIOnAnyMux(t *testing.T) {
+	mux := http.NewServeMux()
+	store := newTestStore()
+	service := newTestService(mux, "item", store)
+	if err := ViewApi(*service, store.model(), nil); err != nil {
+		t.Fatal(err)
+	}
+	ServeOpenAPI(HTTPMux(mux, "/api", testValidator{}), OpenAPIConfig{Info: OpenAPIInfo{Title: "Items"}}, service)
+
+	w := serve(mux, http.MethodGet, "/api/openapi.json", "", nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "/item/view/{id}") {
+		t.Errorf("document = %d: %s", w.Code, w.Body)
+	}
+
+	w = serve(mux, http.MethodGet, "/api/docs", "", nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `\/api\/openapi.json`) {
+		t.Errorf("ui = %d: %s", w.Code, w.Body)
+	}
+	if contentType := w.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/html") {
+		t.Errorf("ui content type = %s", contentType)
+	}
+}
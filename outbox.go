@@ -0,0 +1,318 @@
+package apimaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ErrNotTransactional is returned when events of a service go through the
+// outbox but its model does not implement TransactionalModel.
+var ErrNotTransactional = errors.New("model does not support transactions")
+
+// OutboxEntry is an event waiting in the outbox. Its ID is the ID of the
+// event, which stays the same on every delivery attempt so that consumers can
+// drop duplicates.
+type OutboxEntry struct {
+	ID          string    `json:"id"`
+	Event       Event     `json:"event"`
+	Attempts    int       `json:"attempts"`
+	LastError   string    `json:"last_error,omitempty"`
+	NextAttempt time.Time `json:"next_attempt,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// OutboxWriter writes events to the outbox inside a transaction.
+type OutboxWriter interface {
+	Append(e Event) error
+}
+
+// TransactionalModel is implemented by models whose store can write outbox
+// entries in the same transaction as their changes. Transaction runs fn, in
+// which the model is saved or removed, and commits the changes and the
+// appended events together, or neither when fn fails.
+type TransactionalModel interface {
+	Transaction(fn func(outbox OutboxWriter) error) error
+}
+
+// OutboxStore is read by the OutboxRelay.
+type OutboxStore interface {
+	// Pending returns up to limit entries due at now, oldest first and at
+	// most one per record, so that the events of a record are relayed in order.
+	Pending(now time.Time, limit int) ([]OutboxEntry, error)
+	// MarkDelivered removes a delivered entry.
+	MarkDelivered(id string) error
+	// MarkFailed records a failed attempt and when to try again.
+	MarkFailed(id string, err error, next time.Time) error
+}
+
+// Publisher receives the events relayed from the outbox, for example a
+// message broker client. EventBus is a Publisher.
+type Publisher interface {
+	Publish(e Event) error
+}
+
+// PublisherFunc adapts a function to Publisher.
+type PublisherFunc func(e Event) error
+
+// Publish calls f.
+func (f PublisherFunc) Publish(e Event) error {
+	return f(e)
+}
+
+// ServicePublisher publishes each event to the event bus of the service named
+// by its Resource, so that subscribers such as Webhooks receive the events
+// relayed from the outbox.
+func ServicePublisher(services ...*APIService) Publisher {
+	buses := map[string]*EventBus{}
+	for _, service := range services {
+		buses[service.Name] = service.Events
+	}
+
+	return PublisherFunc(func(e Event) error {
+		bus, ok := buses[e.Resource]
+		if !ok {
+			return fmt.Errorf("no service %q to publish to", e.Resource)
+		}
+		return bus.Publish(e)
+	})
+}
+
+// UseOutbox makes the Create, Edit and Delete operations of the service write
+// their events to the outbox, in the transaction of the model, instead of
+// publishing them. An OutboxRelay then publishes them at least once. The
+// models of the service must implement TransactionalModel.
+func (b *EventBus) UseOutbox() *EventBus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.outbox = true
+	return b
+}
+
+// outboxed reports whether events of type t go through the outbox.
+func (b *EventBus) outboxed(t EventType) bool {
+	if b == nil {
+		return false
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.outbox && (t == EventCreated || t == EventUpdated || t == EventDeleted)
+}
+
+// outboxStage runs a save or remove stage and, when events of type t go
+// through the outbox, appends the event in the same transaction.
+func outboxStage(t EventType, stage Stage) Stage {
+	return Stage{Name: stage.Name, Run: func(s *State) error {
+		if !s.Service.Events.outboxed(t) {
+			return stage.Run(s)
+		}
+
+		model, ok := s.Model.(TransactionalModel)
+		if !ok {
+			return NewStageError(http.StatusInternalServerError, ErrNotTransactional, fmt.Sprintf("cannot store events of %s", s.Service.Name))
+		}
+
+		err := model.Transaction(func(outbox OutboxWriter) error {
+			if err := stage.Run(s); err != nil {
+				return err
+			}
+
+			event, err := s.event(t)
+			if err != nil {
+				return err
+			}
+			event.ID, event.Time = newEventID(), time.Now().UTC()
+
+			if err := outbox.Append(event); err != nil {
+				return NewStageError(http.StatusInternalServerError, err, fmt.Sprintf("cannot store events of %s", s.Service.Name))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		s.outboxed = true
+		return nil
+	}}
+}
+
+// OutboxRelay publishes the entries of an outbox. An entry is only removed
+// once Publisher accepted it, so events are delivered at least once; failed
+// entries are retried with exponential backoff.
+type OutboxRelay struct {
+	Store     OutboxStore
+	Publisher Publisher
+	// Interval between polls of Run, one second by default.
+	Interval time.Duration
+	// BatchSize limits the entries relayed per poll, 100 by default.
+	BatchSize int
+	// Backoff is the delay after the first failed attempt, doubled for every
+	// further one up to MaxBackoff; they default to one second and five minutes.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	Logger     echo.Logger
+}
+
+// NewOutboxRelay creates a relay from store to publisher.
+func NewOutboxRelay(store OutboxStore, publisher Publisher) *OutboxRelay {
+	return &OutboxRelay{
+		Store:      store,
+		Publisher:  publisher,
+		Interval:   time.Second,
+		BatchSize:  100,
+		Backoff:    time.Second,
+		MaxBackoff: 5 * time.Minute,
+	}
+}
+
+// RelayOnce publishes the pending entries and returns how many were delivered.
+func (r *OutboxRelay) RelayOnce() (int, error) {
+	now := time.Now()
+	entries, err := r.Store.Pending(now, r.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	delivered := 0
+	for _, entry := range entries {
+		if err := r.Publisher.Publish(entry.Event); err != nil {
+			if r.Logger != nil {
+				r.Logger.Errorf("outbox entry %s of %s: %v", entry.ID, entry.Event.Resource, err)
+			}
+			if err := r.Store.MarkFailed(entry.ID, err, now.Add(r.backoff(entry.Attempts+1))); err != nil {
+				return delivered, err
+			}
+			continue
+		}
+
+		if err := r.Store.MarkDelivered(entry.ID); err != nil {
+			return delivered, err
+		}
+		delivered++
+	}
+	return delivered, nil
+}
+
+// Run relays the outbox every Interval until ctx is done.
+func (r *OutboxRelay) Run(ctx context.Context) {
+	interval := r.Interval
+	if interval <= 0 {
+		interval = time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := r.RelayOnce(); err != nil && r.Logger != nil {
+			r.Logger.Errorf("outbox relay: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *OutboxRelay) backoff(attempts int) time.Duration {
+	backoff, max := r.Backoff, r.MaxBackoff
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+	if max <= 0 {
+		max = 5 * time.Minute
+	}
+
+	for i := 1; i < attempts && backoff < max; i++ {
+		backoff *= 2
+	}
+	if backoff > max {
+		backoff = max
+	}
+	return backoff
+}
+
+// MemoryOutbox is an OutboxStore kept in memory, written by the transactions
+// of MemoryStore. Several stores may share one outbox.
+type MemoryOutbox struct {
+	mu      sync.Mutex
+	entries []*OutboxEntry
+}
+
+// NewMemoryOutbox creates an empty MemoryOutbox.
+func NewMemoryOutbox() *MemoryOutbox {
+	return &MemoryOutbox{}
+}
+
+// Len returns the number of undelivered entries.
+func (o *MemoryOutbox) Len() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.entries)
+}
+
+func (o *MemoryOutbox) add(events ...Event) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, e := range events {
+		o.entries = append(o.entries, &OutboxEntry{ID: e.ID, Event: e, CreatedAt: e.Time})
+	}
+}
+
+func (o *MemoryOutbox) Pending(now time.Time, limit int) ([]OutboxEntry, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var pending []OutboxEntry
+	seen := map[string]bool{}
+	for _, entry := range o.entries {
+		if limit > 0 && len(pending) >= limit {
+			break
+		}
+
+		key := entry.Event.key()
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		if !entry.NextAttempt.After(now) {
+			pending = append(pending, *entry)
+		}
+	}
+	return pending, nil
+}
+
+func (o *MemoryOutbox) MarkDelivered(id string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for i, entry := range o.entries {
+		if entry.ID == id {
+			o.entries = append(o.entries[:i:i], o.entries[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("outbox entry %s not found", id)
+}
+
+func (o *MemoryOutbox) MarkFailed(id string, err error, next time.Time) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, entry := range o.entries {
+		if entry.ID == id {
+			entry.Attempts++
+			entry.LastError = err.Error()
+			entry.NextAttempt = next
+			return nil
+		}
+	}
+	return fmt.Errorf("outbox entry %s not found", id)
+}
@@ -1,10 +1,6 @@
 package apimaker
 
-import (
-	"strconv"
-
-	"github.com/labstack/echo/v4"
-)
+import "strconv"
 
 type Pagination struct {
 	Limit     int    `query:"limit"`
@@ -13,17 +9,43 @@ type Pagination struct {
 	Unlimited string `query:"unlimited"`
 }
 
-func SetPagination(c echo.Context) (Pagination, error) {
+func SetPagination(c Context) (Pagination, error) {
+	return PaginationPolicy{}.Paginate(c)
+}
+
+// PaginationPolicy bounds the pagination of List requests. Zero fields keep
+// the defaults: 10 records per page, at most 100, and unlimited requests
+// allowed.
+type PaginationPolicy struct {
+	DefaultLimit int
+	MaxLimit     int
+	// DisableUnlimited ignores the unlimited query parameter.
+	DisableUnlimited bool
+	// DefaultSort is used when the request does not sort.
+	DefaultSort string
+}
+
+// Paginate binds the pagination of the request. Limits out of range fall back
+// to the default one.
+func (p PaginationPolicy) Paginate(c Context) (Pagination, error) {
+	defaultLimit, maxLimit := p.DefaultLimit, p.MaxLimit
+	if maxLimit < 1 {
+		maxLimit = 100
+	}
+	if defaultLimit < 1 || defaultLimit > maxLimit {
+		defaultLimit = min(10, maxLimit)
+	}
+
 	pag := new(Pagination)
 	if err := c.Bind(pag); err != nil {
 		return *pag, err
 	}
 
-	if pag.Limit < 1 || pag.Limit > 100 {
-		pag.Limit = 10
+	if pag.Limit < 1 || pag.Limit > maxLimit {
+		pag.Limit = defaultLimit
 	}
 
-	if ok, _ := strconv.ParseBool(pag.Unlimited); ok {
+	if ok, _ := strconv.ParseBool(pag.Unlimited); ok && !p.DisableUnlimited {
 		pag.Limit = -1
 	}
 
@@ -32,7 +54,7 @@ func SetPagination(c echo.Context) (Pagination, error) {
 	}
 
 	if pag.Sort == "" {
-		pag.Sort = ""
+		pag.Sort = p.DefaultSort
 	}
 
 	return *pag, nil
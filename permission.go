@@ -0,0 +1,201 @@
+package apimaker
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// WritePolicy decides what happens when a principal sends a value for a field
+// it is not allowed to write.
+type WritePolicy int
+
+const (
+	// WriteIgnore drops write-protected fields and keeps the model's current value.
+	WriteIgnore WritePolicy = iota
+	// WriteReject fails the request with a FieldPermissionError.
+	WriteReject
+)
+
+// FieldPermissionError is returned when a principal tries to set a field it
+// is not allowed to write.
+type FieldPermissionError struct {
+	Field string
+}
+
+func (e *FieldPermissionError) Error() string {
+	return fmt.Sprintf("not allowed to write field %q", e.Field)
+}
+
+// fieldAccess holds the roles parsed from an api struct tag, for example
+// `api:"read=admin|manager,write=admin"`. Empty role lists mean everyone.
+type fieldAccess struct {
+	Read  []string
+	Write []string
+}
+
+func parseAPITag(tag string) fieldAccess {
+	var access fieldAccess
+	for _, part := range strings.Split(tag, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok || value == "" {
+			continue
+		}
+
+		roles := strings.Split(value, "|")
+		switch key {
+		case "read":
+			access.Read = roles
+		case "write":
+			access.Write = roles
+		}
+	}
+	return access
+}
+
+func (fa fieldAccess) canRead(p *Principal) bool {
+	return len(fa.Read) == 0 || p.HasRole(fa.Read...)
+}
+
+func (fa fieldAccess) canWrite(p *Principal) bool {
+	return len(fa.Write) == 0 || p.HasRole(fa.Write...)
+}
+
+var accessRulesCache sync.Map
+
+// hasAccessRules reports whether t or any type nested in it carries api tags.
+func hasAccessRules(t reflect.Type) bool {
+	t = elemType(t)
+	if t == nil || t.Kind() != reflect.Struct {
+		return false
+	}
+
+	if cached, ok := accessRulesCache.Load(t); ok {
+		return cached.(bool)
+	}
+
+	// guard against recursive types while the answer is being computed
+	accessRulesCache.Store(t, false)
+	found := false
+	for _, f := range jsonFields(t) {
+		if f.Field.Tag.Get("api") != "" || hasAccessRules(f.Field.Type) {
+			found = true
+			break
+		}
+	}
+	accessRulesCache.Store(t, found)
+	return found
+}
+
+// stripUnreadable removes the fields of a generic JSON value that the
+// principal is not allowed to read, following the struct type t.
+func stripUnreadable(value interface{}, t reflect.Type, p *Principal) interface{} {
+	switch v := value.(type) {
+	case []interface{}:
+		for i, item := range v {
+			v[i] = stripUnreadable(item, elemType(t), p)
+		}
+	case map[string]interface{}:
+		t = elemType(t)
+		if t == nil || t.Kind() != reflect.Struct {
+			return value
+		}
+
+		for _, f := range jsonFields(t) {
+			field, ok := v[f.Name]
+			if !ok {
+				continue
+			}
+
+			if !parseAPITag(f.Field.Tag.Get("api")).canRead(p) {
+				delete(v, f.Name)
+				continue
+			}
+			v[f.Name] = stripUnreadable(field, f.Field.Type, p)
+		}
+	}
+	return value
+}
+
+// unwritableFields returns the paths of the fields in value that the principal
+// is not allowed to write according to the api tags of t.
+func unwritableFields(value map[string]interface{}, t reflect.Type, p *Principal, prefix string) []string {
+	t = elemType(t)
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var denied []string
+	for _, f := range jsonFields(t) {
+		field, ok := value[f.Name]
+		if !ok {
+			continue
+		}
+
+		if !parseAPITag(f.Field.Tag.Get("api")).canWrite(p) {
+			denied = append(denied, prefix+f.Name)
+			continue
+		}
+
+		if nested, ok := field.(map[string]interface{}); ok {
+			denied = append(denied, unwritableFields(nested, f.Field.Type, p, prefix+f.Name+".")...)
+		}
+	}
+	return denied
+}
+
+// isZeroJSON reports whether a generic JSON value is the zero value of its kind.
+func isZeroJSON(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case bool:
+		return !v
+	case string:
+		return v == ""
+	case json.Number:
+		f, err := v.Float64()
+		return err == nil && f == 0
+	case []interface{}:
+		return len(v) == 0
+	case map[string]interface{}:
+		for _, item := range v {
+			if !isZeroJSON(item) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// lookupPath returns the value at a dotted path of a generic JSON object.
+func lookupPath(value map[string]interface{}, path string) (interface{}, bool) {
+	parts := strings.Split(path, ".")
+	var current interface{} = value
+	for _, name := range parts {
+		m, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = m[name]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// deletePath removes the value at a dotted path of a generic JSON object.
+func deletePath(value map[string]interface{}, path string) {
+	parts := strings.Split(path, ".")
+	for _, name := range parts[:len(parts)-1] {
+		next, ok := value[name].(map[string]interface{})
+		if !ok {
+			return
+		}
+		value = next
+	}
+	delete(value, parts[len(parts)-1])
+}
@@ -0,0 +1,439 @@
+package apimaker
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Names of the stages the operations are built from, in the order they run.
+// Not every operation has every stage.
+const (
+	StagePaginate     = "paginate"
+	StageAuthenticate = "authenticate"
+	StageAuthorize    = "authorize"
+	StageParent       = "parent"
+	StageFilter       = "filter"
+	StageSelect       = "select"
+	StageFetch        = "fetch"
+	StageBind         = "bind"
+	StageBeforeSave   = "before_save"
+	StageSave         = "save"
+	StageAfterSave    = "after_save"
+	StageAfterFind    = "after_find"
+	StageBeforeList   = "before_list"
+	StageList         = "list"
+	StageAfterList    = "after_list"
+	StageBeforeRemove = "before_remove"
+	StageRemove       = "remove"
+	StageAfterRemove  = "after_remove"
+	StagePublish      = "publish"
+	StageRespond      = "respond"
+)
+
+// State carries a request through the stages of an operation. Stages and
+// interceptors read and update it; fields not used by an operation stay zero.
+type State struct {
+	Operation Operation
+	Service   *APIService
+	Context   Context
+	Security  Security
+	Model     Model
+	Form      Form
+	// Filter is the filter passed to Model.List, including parent constraints.
+	Filter   Filter
+	ID       string
+	ParentID string
+	// Before is a snapshot of the model taken before Edit or Delete changed
+	// it, when the event bus of the service has subscribers for it.
+	Before     interface{}
+	Pagination Pagination
+	Fields     []string
+	Includes   []Relation
+	// List, TotalCounts and TotalPages hold the result of Model.List.
+	List        interface{}
+	TotalCounts int
+	TotalPages  int
+
+	// outboxed is set once the event of the operation is in the outbox.
+	outboxed bool
+	// fetched is set once Model holds the record addressed by ID.
+	fetched bool
+	// old is a copy of the model taken before Edit changed it, for hooks.
+	old Model
+	// response replaces the respond stage once a hook answered the request;
+	// skip makes the stages up to respond be skipped.
+	response func(s *State) error
+	skip     bool
+}
+
+// Stage is a named step of an operation.
+type Stage struct {
+	Name string
+	Run  func(s *State) error
+}
+
+// StageError makes the pipeline answer with an error response. Like
+// ErrorResponse, the message of Err is sent when present and Message otherwise.
+type StageError struct {
+	Code    int
+	Message string
+	Err     error
+}
+
+// NewStageError creates a StageError.
+func NewStageError(code int, err error, message string) *StageError {
+	return &StageError{Code: code, Message: message, Err: err}
+}
+
+func (e *StageError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+func (e *StageError) Unwrap() error {
+	return e.Err
+}
+
+// ErrResponded stops the pipeline without an error, for interceptors that have
+// written the response themselves.
+var ErrResponded = errors.New("response already written")
+
+// Interceptor wraps every stage of the operations it is registered for.
+// It runs the stage by calling next and may inspect or change the state
+// before and after, or stop the operation by returning an error instead.
+type Interceptor interface {
+	Intercept(s *State, stage string, next func() error) error
+}
+
+// InterceptorFunc adapts a function to Interceptor.
+type InterceptorFunc func(s *State, stage string, next func() error) error
+
+// Intercept calls f.
+func (f InterceptorFunc) Intercept(s *State, stage string, next func() error) error {
+	return f(s, stage, next)
+}
+
+// Before runs fn before the named stage; an error skips the stage.
+func Before(stage string, fn func(s *State) error) Interceptor {
+	return InterceptorFunc(func(s *State, name string, next func() error) error {
+		if name == stage {
+			if err := fn(s); err != nil {
+				return err
+			}
+		}
+		return next()
+	})
+}
+
+// After runs fn once the named stage has succeeded.
+func After(stage string, fn func(s *State) error) Interceptor {
+	return InterceptorFunc(func(s *State, name string, next func() error) error {
+		if err := next(); err != nil || name != stage {
+			return err
+		}
+		return fn(s)
+	})
+}
+
+// Around wraps the named stage with fn, which runs the stage by calling next.
+func Around(stage string, fn func(s *State, next func() error) error) Interceptor {
+	return InterceptorFunc(func(s *State, name string, next func() error) error {
+		if name != stage {
+			return next()
+		}
+		return fn(s, next)
+	})
+}
+
+// ForOperations limits an interceptor to the given operations.
+func ForOperations(interceptor Interceptor, operations ...Operation) Interceptor {
+	return InterceptorFunc(func(s *State, stage string, next func() error) error {
+		for _, operation := range operations {
+			if s.Operation == operation {
+				return interceptor.Intercept(s, stage, next)
+			}
+		}
+		return next()
+	})
+}
+
+// AccessControl marks an interceptor as controlling access to records.
+// Records embedded with include only run through the marked interceptors of
+// the related service, so that rate limits, audits and the like count the
+// request once. RecordRule, Tenancy and RBACPolicy mark theirs.
+func AccessControl(interceptor Interceptor) Interceptor {
+	return accessInterceptor{interceptor}
+}
+
+type accessInterceptor struct {
+	Interceptor
+}
+
+// accessControls returns the interceptors of chain marked with AccessControl.
+func accessControls(chain []Interceptor) []Interceptor {
+	var controls []Interceptor
+	for _, interceptor := range chain {
+		if _, ok := interceptor.(accessInterceptor); ok {
+			controls = append(controls, interceptor)
+		}
+	}
+	return controls
+}
+
+// interceptorRegistry is shared by copies of an APIService, like routeRegistry.
+type interceptorRegistry struct {
+	mu           sync.RWMutex
+	interceptors []Interceptor
+}
+
+func (r *interceptorRegistry) add(interceptors ...Interceptor) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.interceptors = append(r.interceptors, interceptors...)
+}
+
+func (r *interceptorRegistry) list() []Interceptor {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]Interceptor(nil), r.interceptors...)
+}
+
+var globalInterceptors = &interceptorRegistry{}
+
+// Use registers interceptors for every operation of every service. Global
+// interceptors run outside those of a service, which run outside those of a
+// single request.
+func Use(interceptors ...Interceptor) {
+	globalInterceptors.add(interceptors...)
+}
+
+// Use registers interceptors for every operation of the service.
+func (a *APIService) Use(interceptors ...Interceptor) *APIService {
+	if a.interceptors == nil {
+		a.interceptors = &interceptorRegistry{}
+	}
+	a.interceptors.add(interceptors...)
+	return a
+}
+
+// run executes the stages in order, each wrapped by the global, service and
+// request interceptors, and turns a failure into an error response. The
+// resource and operation are stored in the context for RequestOperation.
+func (a APIService) run(s *State, stages []Stage, interceptors []Interceptor) error {
+	err := a.runStages(s, stages, interceptors)
+	if err == nil || errors.Is(err, ErrResponded) {
+		return nil
+	}
+
+	var stageErr *StageError
+	errors.As(err, &stageErr)
+	return a.ErrorResponse(s.Context, stageErr.Code, stageErr.Err, stageErr.Message)
+}
+
+// runStages runs the stages like run without answering the request. Errors
+// other than ErrResponded are returned as StageErrors, 500 when a stage
+// failed with another error.
+func (a APIService) runStages(s *State, stages []Stage, interceptors []Interceptor) error {
+	return a.runChain(s, stages, a.chain(interceptors))
+}
+
+// chain returns the global, service and request interceptors, outermost first.
+func (a APIService) chain(interceptors []Interceptor) []Interceptor {
+	chain := append(globalInterceptors.list(), a.interceptors.list()...)
+	return append(chain, interceptors...)
+}
+
+// runChain runs the stages like runStages, wrapped by the given chain.
+func (a APIService) runChain(s *State, stages []Stage, chain []Interceptor) error {
+	s.Context.Set(operationKey, requestOperation{resource: a.Name, operation: s.Operation})
+
+	for _, stage := range stages {
+		if stage.Name == StageRespond && s.response != nil {
+			stage = Stage{Name: StageRespond, Run: s.response}
+		} else if s.skip {
+			continue
+		}
+
+		if err := runStage(s, stage, chain); err != nil {
+			var stageErr *StageError
+			if errors.Is(err, ErrResponded) || errors.As(err, &stageErr) {
+				return err
+			}
+			return NewStageError(http.StatusInternalServerError, err, fmt.Sprintf("%s of %s failed", stage.Name, a.Name))
+		}
+	}
+	return nil
+}
+
+// runStage runs a stage through the chain, the first interceptor outermost.
+func runStage(s *State, stage Stage, chain []Interceptor) error {
+	next := func() error { return stage.Run(s) }
+	for i := len(chain) - 1; i >= 0; i-- {
+		interceptor, inner := chain[i], next
+		next = func() error { return interceptor.Intercept(s, stage.Name, inner) }
+	}
+	return next()
+}
+
+// Stages shared by the operations.
+
+func authenticateStage() Stage {
+	return Stage{Name: StageAuthenticate, Run: func(s *State) error {
+		if s.Security.Authenticator != nil {
+			if authenticated, err := s.Security.Authenticator(s.Context); err != nil || !authenticated {
+				// authenticators may answer with another status, e.g. 403
+				var stageErr *StageError
+				if errors.As(err, &stageErr) {
+					return stageErr
+				}
+				return NewStageError(http.StatusUnauthorized, err, "authentication failed")
+			}
+		}
+		return nil
+	}}
+}
+
+// adminAuthenticateStage is authenticateStage for endpoints exposing every
+// record or managing credentials, which are refused rather than left open
+// when no Security applies.
+func adminAuthenticateStage() Stage {
+	authenticate := authenticateStage()
+	return Stage{Name: StageAuthenticate, Run: func(s *State) error {
+		if !s.Security.set() {
+			return NewStageError(http.StatusForbidden, fmt.Errorf("no security configured for %s of %s", s.Operation, s.Service.Name), "authorization failed")
+		}
+		return authenticate.Run(s)
+	}}
+}
+
+func authorizeStage() Stage {
+	return Stage{Name: StageAuthorize, Run: func(s *State) error {
+		if s.Security.Authorizer != nil {
+			if authorized, err := s.Security.Authorizer(s.Context); err != nil || !authorized {
+				return NewStageError(http.StatusForbidden, err, "authorization failed")
+			}
+		}
+
+		if s.Security.Policy != nil {
+			if authorized, err := s.Security.Policy.Authorize(s.Context, s.Service.Name, s.Operation); err != nil || !authorized {
+				return NewStageError(http.StatusForbidden, err, "authorization failed")
+			}
+		}
+		return nil
+	}}
+}
+
+func parentStage() Stage {
+	return Stage{Name: StageParent, Run: func(s *State) error {
+		parentID, err := s.Service.loadParent(s.Context)
+		if err != nil {
+			return NewStageError(http.StatusNotFound, err, "parent not found")
+		}
+		s.ParentID = parentID
+		return nil
+	}}
+}
+
+// fetchStage loads the model addressed by the route; records of another
+// parent are not found.
+func fetchStage() Stage {
+	return Stage{Name: StageFetch, Run: func(s *State) error {
+		if err := s.fetch(); err != nil {
+			return NewStageError(http.StatusBadRequest, err, fmt.Sprintf("cannot find any %s", s.Service.Name))
+		}
+
+		if err := s.Service.checkParent(s.Model, s.ParentID); err != nil {
+			return NewStageError(http.StatusNotFound, err, fmt.Sprintf("cannot find any %s", s.Service.Name))
+		}
+		return nil
+	}}
+}
+
+// fetch loads the model addressed by the route, unless a stage already did.
+func (s *State) fetch() error {
+	if s.fetched {
+		return nil
+	}
+	if err := s.Model.GetOne(s.ID); err != nil {
+		return err
+	}
+	s.fetched = true
+	return nil
+}
+
+// bindStage binds the form onto the model, honouring field write permissions,
+// and stamps the parent of the route on the models of nested resources so a
+// form cannot move them to another parent.
+func bindStage() Stage {
+	return Stage{Name: StageBind, Run: func(s *State) error {
+		if err := BindStructWithPolicy(s.Context, s.Form, s.Model, s.Service.WritePolicy); err != nil {
+			var permErr *FieldPermissionError
+			if errors.As(err, &permErr) {
+				return NewStageError(http.StatusForbidden, err, "field not writable")
+			}
+			return NewStageError(http.StatusBadRequest, err, "failed to bind form")
+		}
+
+		if err := s.Form.Bind(s.Model); err != nil {
+			return NewStageError(http.StatusBadRequest, err, "failed to bind form data")
+		}
+
+		if err := s.Service.stampParent(s.Model, s.ParentID); err != nil {
+			return NewStageError(http.StatusInternalServerError, err, fmt.Sprintf("cannot set parent of %s", s.Service.Name))
+		}
+		return nil
+	}}
+}
+
+// selectStage validates the fields and include query parameters.
+func selectStage() Stage {
+	return Stage{Name: StageSelect, Run: func(s *State) error {
+		s.Fields = ParseFields(s.Context)
+		if err := selectFields(s.Model, s.Fields); err != nil {
+			return NewStageError(http.StatusBadRequest, err, "invalid fields")
+		}
+
+		includes, err := s.Service.lookupRelations(ParseIncludes(s.Context))
+		if err != nil {
+			return NewStageError(http.StatusBadRequest, err, "invalid include")
+		}
+		s.Includes = includes
+		return nil
+	}}
+}
+
+// hookStage calls a user supplied hook with the model, or with a HookContext.
+// StageErrors of the hook are answered as they are and other errors with 400.
+func hookStage(name string, hook CreateFunc, label string) Stage {
+	return Stage{Name: name, Run: func(s *State) error {
+		var err error
+		switch {
+		case hook.Hook != nil:
+			err = hook.Hook(newHookContext(s, hook.Params))
+		case hook.Function != nil:
+			err = hook.Function(s.Model, hook.Params...)
+		}
+
+		var stageErr *StageError
+		switch {
+		case err == nil:
+			return nil
+		case errors.Is(err, errHookResponded):
+			// hooks running before the change skip it and answer at once
+			s.skip = strings.HasPrefix(name, "before_")
+			return nil
+		case errors.As(err, &stageErr), errors.Is(err, ErrResponded):
+			return err
+		}
+		return NewStageError(http.StatusBadRequest, err, fmt.Sprintf("cannot use function %s, error : %s ", label, err.Error()))
+	}}
+}
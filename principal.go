@@ -0,0 +1,41 @@
+package apimaker
+
+// principalKey is the context key the authenticated principal is stored under.
+const principalKey = "apimaker.principal"
+
+// Principal describes the authenticated caller of a request.
+// Authenticators store it in the context with SetPrincipal so that
+// authorizers, hooks and field permissions can inspect it.
+type Principal struct {
+	ID     string
+	Roles  []string
+	Claims map[string]interface{}
+}
+
+// HasRole reports whether the principal has at least one of the given roles.
+func (p *Principal) HasRole(roles ...string) bool {
+	if p == nil {
+		return false
+	}
+
+	for _, want := range roles {
+		for _, role := range p.Roles {
+			if role == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SetPrincipal stores the authenticated principal in the request context.
+func SetPrincipal(c Context, p *Principal) {
+	c.Set(principalKey, p)
+}
+
+// GetPrincipal returns the principal stored in the request context, or nil
+// when the request is anonymous.
+func GetPrincipal(c Context) *Principal {
+	p, _ := c.Get(principalKey).(*Principal)
+	return p
+}
@@ -0,0 +1,290 @@
+package apimaker
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// RateLimitAlgorithm selects how a RateLimit counts requests.
+type RateLimitAlgorithm string
+
+const (
+	// TokenBucket refills Requests tokens per Window up to Burst, allowing
+	// short bursts over the average rate.
+	TokenBucket RateLimitAlgorithm = "token_bucket"
+	// SlidingWindow allows Requests per Window, weighting the count of the
+	// previous window by how much of it overlaps the sliding one.
+	SlidingWindow RateLimitAlgorithm = "sliding_window"
+)
+
+// RateLimit allows Requests per Window to each key.
+type RateLimit struct {
+	Requests int
+	Window   time.Duration
+	// Burst is the capacity of a token bucket, Requests by default.
+	Burst     int
+	Algorithm RateLimitAlgorithm
+	// Key identifies the client of a request, RateLimitByPrincipal by default.
+	Key func(c Context) string
+}
+
+// RateLimitResult is the outcome of counting a request.
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is the time until the limit is fully available again and
+	// RetryAfter the time until a denied request would be allowed.
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// RateLimitStore counts the requests of keys. MemoryRateLimitStore keeps the
+// counters of a single process; a shared store lets several instances
+// enforce one limit.
+type RateLimitStore interface {
+	Take(key string, limit RateLimit, now time.Time) (RateLimitResult, error)
+}
+
+// RateLimitByIP keys requests by client IP address, as returned by ClientIP.
+func RateLimitByIP(c Context) string {
+	return "ip:" + ClientIP(c.Request())
+}
+
+// RateLimitByPrincipal keys requests by principal, or by IP address for
+// anonymous requests.
+func RateLimitByPrincipal(c Context) string {
+	if principal := GetPrincipal(c); principal != nil && principal.ID != "" {
+		return "principal:" + principal.ID
+	}
+	return RateLimitByIP(c)
+}
+
+// RateLimitByAPIKey keys requests by API key, or like RateLimitByPrincipal
+// without one.
+func RateLimitByAPIKey(c Context) string {
+	if key := GetAPIKey(c); key != nil {
+		return "apikey:" + key.ID
+	}
+	return RateLimitByPrincipal(c)
+}
+
+// RateLimiter limits the operations of services. Requests are counted once
+// authenticated, so that they can be keyed by principal; requests failing
+// authentication are counted by IP address. Limited requests are answered
+// with 429 and every counted request gets the RateLimit-Limit,
+// RateLimit-Remaining and RateLimit-Reset headers.
+type RateLimiter struct {
+	Store RateLimitStore
+	// Logger reports store failures, on which requests are allowed.
+	Logger echo.Logger
+
+	mu     sync.RWMutex
+	limits map[Operation]RateLimit
+}
+
+// NewRateLimiter creates a limiter counting in store, a MemoryRateLimitStore
+// when nil.
+func NewRateLimiter(store RateLimitStore) *RateLimiter {
+	if store == nil {
+		store = NewMemoryRateLimitStore()
+	}
+	return &RateLimiter{Store: store, limits: map[Operation]RateLimit{}}
+}
+
+// Limit sets the limit of the given operations, or of every operation without
+// a limit of its own when none is given.
+func (l *RateLimiter) Limit(limit RateLimit, operations ...Operation) *RateLimiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(operations) == 0 {
+		operations = []Operation{""}
+	}
+	for _, operation := range operations {
+		l.limits[operation] = limit
+	}
+	return l
+}
+
+func (l *RateLimiter) limit(operation Operation) (RateLimit, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if limit, ok := l.limits[operation]; ok {
+		return limit, true
+	}
+	limit, ok := l.limits[""]
+	return limit, ok
+}
+
+// Apply limits every operation of service. Each service has its own counters,
+// even when they share the limiter.
+func (l *RateLimiter) Apply(service *APIService) *APIService {
+	return service.Use(Around(StageAuthenticate, func(s *State, next func() error) error {
+		authErr := next()
+
+		limit, ok := l.limit(s.Operation)
+		if !ok || limit.Requests <= 0 || limit.Window <= 0 {
+			return authErr
+		}
+
+		key := RateLimitByIP(s.Context)
+		if authErr == nil {
+			keyFunc := limit.Key
+			if keyFunc == nil {
+				keyFunc = RateLimitByPrincipal
+			}
+			key = keyFunc(s.Context)
+		}
+
+		result, err := l.Store.Take(s.Service.Name+":"+string(s.Operation)+":"+key, limit, time.Now())
+		if err != nil {
+			if l.Logger != nil {
+				l.Logger.Errorf("rate limit of %s: %v", s.Service.Name, err)
+			}
+			return authErr
+		}
+
+		if header := responseHeader(s.Context); header != nil {
+			header.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+			header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			header.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+			if !result.Allowed {
+				header.Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			}
+		}
+
+		if !result.Allowed {
+			return NewStageError(http.StatusTooManyRequests, errors.New("rate limit exceeded"), "too many requests")
+		}
+		return authErr
+	}))
+}
+
+// ceilSeconds rounds d up to whole seconds for the rate limit headers.
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// MemoryRateLimitStore is an in-memory RateLimitStore. Counters are dropped
+// once they are back to their full limit.
+type MemoryRateLimitStore struct {
+	mu       sync.Mutex
+	counters map[string]*rateCounter
+	swept    time.Time
+}
+
+// rateCounter holds a token bucket, in tokens and updated, or the counts of
+// the current and previous windows of a sliding window, and when it is full
+// again.
+type rateCounter struct {
+	tokens  float64
+	updated time.Time
+
+	start    time.Time
+	current  int
+	previous int
+
+	expires time.Time
+}
+
+// NewMemoryRateLimitStore creates an empty store.
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{counters: map[string]*rateCounter{}}
+}
+
+// Take counts a request of key at now.
+func (m *MemoryRateLimitStore) Take(key string, limit RateLimit, now time.Time) (RateLimitResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if now.Sub(m.swept) > time.Minute {
+		for k, counter := range m.counters {
+			if now.After(counter.expires) {
+				delete(m.counters, k)
+			}
+		}
+		m.swept = now
+	}
+
+	counter, ok := m.counters[key]
+	if !ok {
+		counter = &rateCounter{}
+		m.counters[key] = counter
+	}
+	counter.expires = now.Add(2 * limit.Window)
+
+	if limit.Algorithm == SlidingWindow {
+		return counter.slidingWindow(limit, now), nil
+	}
+	return counter.tokenBucket(limit, now, !ok), nil
+}
+
+func (r *rateCounter) tokenBucket(limit RateLimit, now time.Time, fresh bool) RateLimitResult {
+	capacity := float64(limit.Burst)
+	if limit.Burst <= 0 {
+		capacity = float64(limit.Requests)
+	}
+	rate := float64(limit.Requests) / limit.Window.Seconds()
+
+	if fresh {
+		r.tokens = capacity
+	} else {
+		r.tokens = math.Min(capacity, r.tokens+now.Sub(r.updated).Seconds()*rate)
+	}
+	r.updated = now
+
+	result := RateLimitResult{Limit: int(capacity)}
+	if r.tokens >= 1 {
+		r.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration((1 - r.tokens) / rate * float64(time.Second))
+	}
+	result.Remaining = int(r.tokens)
+	result.Reset = time.Duration((capacity - r.tokens) / rate * float64(time.Second))
+	r.expires = now.Add(result.Reset)
+	return result
+}
+
+func (r *rateCounter) slidingWindow(limit RateLimit, now time.Time) RateLimitResult {
+	start := now.Truncate(limit.Window)
+	if !start.Equal(r.start) {
+		if start.Sub(r.start) == limit.Window {
+			r.previous = r.current
+		} else {
+			r.previous = 0
+		}
+		r.start, r.current = start, 0
+	}
+
+	elapsed := now.Sub(start)
+	weight := 1 - float64(elapsed)/float64(limit.Window)
+	count := float64(r.previous)*weight + float64(r.current)
+
+	result := RateLimitResult{Limit: limit.Requests, Reset: limit.Window - elapsed}
+	if count+1 <= float64(limit.Requests) {
+		r.current++
+		count++
+		result.Allowed = true
+	} else if r.current+1 > limit.Requests {
+		result.RetryAfter = limit.Window - elapsed
+	} else {
+		// wait until enough of the previous window has slid out
+		needed := 1 - float64(limit.Requests-r.current-1)/float64(r.previous)
+		result.RetryAfter = time.Duration(needed*float64(limit.Window)) - elapsed
+	}
+
+	result.Remaining = limit.Requests - int(math.Ceil(count))
+	if result.Remaining < 0 {
+		result.Remaining = 0
+	}
+	return result
+}
@@ -0,0 +1,104 @@
+package apimaker
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTokenBucketLimit(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	limit := RateLimit{Requests: 2, Window: time.Second, Algorithm: TokenBucket}
+	now := time.Unix(1000, 0)
+
+	for i := 0; i < 2; i++ {
+		if result, _ := store.Take("k", limit, now); !result.Allowed {
+			t.Fatalf("request %d denied", i+1)
+		}
+	}
+	result, _ := store.Take("k", limit, now)
+	if result.Allowed || result.RetryAfter != 500*time.Millisecond {
+		t.Errorf("third request = %+v, want denied for 500ms", result)
+	}
+	if result, _ := store.Take("k", limit, now.Add(500*time.Millisecond)); !result.Allowed {
+		t.Error("request after a token refilled denied")
+	}
+}
+
+func TestSlidingWindowLimit(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	limit := RateLimit{Requests: 2, Window: time.Minute, Algorithm: SlidingWindow}
+	start := time.Unix(0, 0).Add(time.Hour)
+
+	for i := 0; i < 2; i++ {
+		if result, _ := store.Take("k", limit, start); !result.Allowed {
+			t.Fatalf("request %d denied", i+1)
+		}
+	}
+	if result, _ := store.Take("k", limit, start.Add(59*time.Second)); result.Allowed {
+		t.Error("third request in the window allowed")
+	}
+	// half of the previous window still counts as one request
+	if result, _ := store.Take("k", limit, start.Add(90*time.Second)); !result.Allowed {
+		t.Error("request once half the window slid out denied")
+	}
+	if result, _ := store.Take("k", limit, start.Add(90*time.Second)); result.Allowed {
+		t.Error("request over the weighted count allowed")
+	}
+}
+
+func TestRateLimiterAnswers429(t *testing.T) {
+	for _, algorithm := range []RateLimitAlgorithm{TokenBucket, SlidingWindow} {
+		mux := http.NewServeMux()
+		store := newTestStore()
+		service := newTestService(mux, "item", store)
+		NewRateLimiter(nil).Limit(RateLimit{Requests: 2, Window: time.Hour, Algorithm: algorithm, Key: RateLimitByIP}).Apply(service)
+		if err := ListApi(*service, store.model(), new(testItemFilter)); err != nil {
+			t.Fatal(err)
+		}
+
+		for i := 1; i <= 3; i++ {
+			w := serve(mux, http.MethodGet, "/item/list", "", nil)
+			want := http.StatusOK
+			if i == 3 {
+				want = http.StatusTooManyRequests
+			}
+			if w.Code != want {
+				t.Errorf("%s: request %d = %d, want %d", algorithm, i, w.Code, want)
+			}
+			if i == 3 && w.Header().Get("Retry-After") == "" {
+				t.Errorf("%s: limited request without Retry-After", algorithm)
+			}
+		}
+	}
+}
+
+func TestClientIPTrustsOnlyConfiguredProxies(t *testing.T) {
+	t.Cleanup(func() { TrustProxies() })
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "10.0.0.2:1234"
+	r.Header.Set("X-Forwarded-For", "1.1.1.1, 2.2.2.2, 10.0.0.1")
+	r.Header.Set("X-Real-Ip", "3.3.3.3")
+
+	if ip := ClientIP(r); ip != "10.0.0.2" {
+		t.Errorf("client IP without trusted proxies = %s, want the remote address", ip)
+	}
+
+	if err := TrustProxies("10.0.0.0/8"); err != nil {
+		t.Fatal(err)
+	}
+	if ip := ClientIP(r); ip != "2.2.2.2" {
+		t.Errorf("client IP behind trusted proxies = %s, want the last untrusted address", ip)
+	}
+
+	r.Header.Del("X-Forwarded-For")
+	if ip := ClientIP(r); ip != "3.3.3.3" {
+		t.Errorf("client IP from X-Real-Ip = %s", ip)
+	}
+
+	if err := TrustProxies("not an address"); err == nil {
+		t.Error("invalid proxy accepted")
+	}
+}
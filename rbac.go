@@ -0,0 +1,225 @@
+package apimaker
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// operationKey is the context key the resource and operation of the request
+// are stored under.
+const operationKey = "apimaker.operation"
+
+// Policy authorizes operations knowing which resource and operation they are,
+// unlike Security.Authorizer.
+type Policy interface {
+	Authorize(c Context, resource string, operation Operation) (bool, error)
+}
+
+// PolicyFunc adapts a function to Policy.
+type PolicyFunc func(c Context, resource string, operation Operation) (bool, error)
+
+// Authorize calls f.
+func (f PolicyFunc) Authorize(c Context, resource string, operation Operation) (bool, error) {
+	return f(c, resource, operation)
+}
+
+// requestOperation is what RequestOperation returns.
+type requestOperation struct {
+	resource  string
+	operation Operation
+}
+
+// RequestOperation returns the resource and operation of the request, so
+// that authenticators, authorizers and hooks can tell what they guard.
+func RequestOperation(c Context) (string, Operation) {
+	current, _ := c.Get(operationKey).(requestOperation)
+	return current.resource, current.operation
+}
+
+// permissionAllows reports whether a "resource:operation" permission covers
+// an operation of resource. Either part may be "*", and "update" is accepted
+// for the edit operation.
+func permissionAllows(permission, resource string, operation Operation) bool {
+	return permissionCovers(permission, resource+":"+string(operation))
+}
+
+// permissionOperation returns the operation of a permission, with "update"
+// read as the edit operation.
+func permissionOperation(permission string) (string, string) {
+	resource, operation, _ := strings.Cut(permission, ":")
+	if operation == "update" {
+		operation = string(OperationEdit)
+	}
+	return resource, operation
+}
+
+// RBACRule overrides the permissions required by one operation of a resource.
+type RBACRule struct {
+	// Public operations need no permission.
+	Public bool `json:"public,omitempty" yaml:"public,omitempty"`
+	// Permissions, any of which grants the operation, replace the default
+	// "resource:operation".
+	Permissions []string `json:"permissions,omitempty" yaml:"permissions,omitempty"`
+}
+
+// RBACPolicy is a role based Policy. Roles map to permissions such as
+// "product:create", "product:update", "product:*" or "*:view"; a principal
+// may run an operation when one of its roles has a permission for it.
+// Resources override the rules of single operations by resource name.
+type RBACPolicy struct {
+	Roles     map[string][]string               `json:"roles" yaml:"roles"`
+	Resources map[string]map[Operation]RBACRule `json:"resources,omitempty" yaml:"resources,omitempty"`
+}
+
+// NewRBACPolicy creates an empty policy.
+func NewRBACPolicy() *RBACPolicy {
+	return &RBACPolicy{Roles: map[string][]string{}, Resources: map[string]map[Operation]RBACRule{}}
+}
+
+// LoadRBACPolicy reads a policy from a YAML or JSON file.
+func LoadRBACPolicy(path string) (*RBACPolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	policy, err := ParseRBACPolicy(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return policy, nil
+}
+
+// ParseRBACPolicy decodes and validates a YAML, or JSON, policy. Unknown keys
+// are rejected.
+func ParseRBACPolicy(data []byte) (*RBACPolicy, error) {
+	policy := NewRBACPolicy()
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(policy); err != nil {
+		return nil, fmt.Errorf("invalid policy: %w", err)
+	}
+
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// Validate checks that every permission has the "resource:operation" form.
+func (p *RBACPolicy) Validate() error {
+	var errs []error
+	check := func(where, permission string) {
+		resource, operation, found := strings.Cut(permission, ":")
+		if !found || resource == "" || operation == "" {
+			errs = append(errs, fmt.Errorf("%s: invalid permission %q, expected resource:operation", where, permission))
+		}
+	}
+
+	roles := make([]string, 0, len(p.Roles))
+	for role := range p.Roles {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+	for _, role := range roles {
+		for _, permission := range p.Roles[role] {
+			check("role "+role, permission)
+		}
+	}
+
+	for resource, rules := range p.Resources {
+		for operation, rule := range rules {
+			if rule.Public && len(rule.Permissions) > 0 {
+				errs = append(errs, fmt.Errorf("resource %s: %s is public and has permissions", resource, operation))
+			}
+			for _, permission := range rule.Permissions {
+				check("resource "+resource, permission)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Grant adds permissions to a role.
+func (p *RBACPolicy) Grant(role string, permissions ...string) *RBACPolicy {
+	if p.Roles == nil {
+		p.Roles = map[string][]string{}
+	}
+	p.Roles[role] = append(p.Roles[role], permissions...)
+	return p
+}
+
+// Override replaces the rule of an operation of resource.
+func (p *RBACPolicy) Override(resource string, operation Operation, rule RBACRule) *RBACPolicy {
+	if p.Resources == nil {
+		p.Resources = map[string]map[Operation]RBACRule{}
+	}
+	if p.Resources[resource] == nil {
+		p.Resources[resource] = map[Operation]RBACRule{}
+	}
+	p.Resources[resource][operation] = rule
+	return p
+}
+
+// Authorize implements Policy for the principal of the request.
+func (p *RBACPolicy) Authorize(c Context, resource string, operation Operation) (bool, error) {
+	rule, overridden := p.Resources[resource][operation]
+	if overridden && rule.Public {
+		return true, nil
+	}
+
+	principal := GetPrincipal(c)
+	if principal == nil {
+		return false, errors.New("no principal")
+	}
+
+	for _, role := range principal.Roles {
+		for _, permission := range p.Roles[role] {
+			if overridden && len(rule.Permissions) > 0 {
+				for _, required := range rule.Permissions {
+					if permissionCovers(permission, required) {
+						return true, nil
+					}
+				}
+				continue
+			}
+
+			if permissionAllows(permission, resource, operation) {
+				return true, nil
+			}
+		}
+	}
+
+	if overridden && len(rule.Permissions) > 0 {
+		return false, fmt.Errorf("missing permission %s", strings.Join(rule.Permissions, " or "))
+	}
+	return false, fmt.Errorf("missing permission %s:%s", resource, operation)
+}
+
+// permissionCovers reports whether a granted permission, possibly with
+// wildcards, covers a required one; "update" and "edit" are the same
+// operation on both sides.
+func permissionCovers(granted, required string) bool {
+	resource, operation := permissionOperation(required)
+	grantedResource, grantedOperation := permissionOperation(granted)
+	return (grantedResource == "*" || grantedResource == resource) &&
+		(grantedOperation == "*" || grantedOperation == operation)
+}
+
+// Apply makes every operation of service authorized by the policy, after the
+// authorizer of its Security.
+func (p *RBACPolicy) Apply(service *APIService) *APIService {
+	return service.Use(AccessControl(After(StageAuthorize, func(s *State) error {
+		if authorized, err := p.Authorize(s.Context, s.Service.Name, s.Operation); err != nil || !authorized {
+			return NewStageError(http.StatusForbidden, err, "authorization failed")
+		}
+		return nil
+	})))
+}
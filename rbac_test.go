@@ -0,0 +1,84 @@
+package apimaker
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRBACPolicy(t *testing.T) {
+	mux := http.NewServeMux()
+	store := newTestStore()
+	service := newTestService(mux, "item", store)
+	policy := NewRBACPolicy().
+		Grant("viewer", "item:view").
+		Grant("admin", "*:*").
+		Override("item", OperationList, RBACRule{Public: true})
+	service.Configure().WithSecurity(Security{
+		Authenticator: func(c Context) (bool, error) {
+			if roles := c.Request().Header.Get("X-Roles"); roles != "" {
+				SetPrincipal(c, &Principal{ID: "u", Roles: strings.Split(roles, ",")})
+			}
+			return true, nil
+		},
+		Policy: policy,
+	})
+	for _, register := range []func() error{
+		func() error { return ViewApi(*service, store.model(), nil) },
+		func() error { return ListApi(*service, store.model(), new(testItemFilter)) },
+		func() error { return DeleteApi(*service, store.model(), nil) },
+	} {
+		if err := register(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		if err := store.model().Save(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, test := range []struct {
+		method, path, roles string
+		want                int
+	}{
+		{http.MethodGet, "/item/view/1", "viewer", http.StatusOK},
+		{http.MethodDelete, "/item/delete/1", "viewer", http.StatusForbidden},
+		{http.MethodGet, "/item/view/1", "", http.StatusForbidden},
+		{http.MethodGet, "/item/list", "", http.StatusOK},
+		{http.MethodDelete, "/item/delete/2", "admin", http.StatusOK},
+	} {
+		header := http.Header{}
+		if test.roles != "" {
+			header.Set("X-Roles", test.roles)
+		}
+		if w := serve(mux, test.method, test.path, "", header); w.Code != test.want {
+			t.Errorf("%s %s as %q = %d, want %d: %s", test.method, test.path, test.roles, w.Code, test.want, w.Body)
+		}
+	}
+}
+
+func TestRBACUpdateIsEdit(t *testing.T) {
+	principal := func(role string) Context {
+		c := NewHTTPContext(nil, nil, nil, nil)
+		SetPrincipal(c, &Principal{ID: "u", Roles: []string{role}})
+		return c
+	}
+
+	plain := NewRBACPolicy().Grant("updater", "product:update").Grant("editor", "product:edit")
+	overridden := NewRBACPolicy().Grant("updater", "product:update").Grant("editor", "product:edit").
+		Override("product", OperationEdit, RBACRule{Permissions: []string{"product:edit"}})
+	renamed := NewRBACPolicy().Grant("editor", "product:edit").
+		Override("product", OperationEdit, RBACRule{Permissions: []string{"product:update"}})
+
+	for name, policy := range map[string]*RBACPolicy{"plain": plain, "overridden": overridden, "renamed": renamed} {
+		for _, role := range []string{"updater", "editor"} {
+			if _, granted := policy.Roles[role]; !granted {
+				continue
+			}
+			if ok, err := policy.Authorize(principal(role), "product", OperationEdit); !ok {
+				t.Errorf("%s policy denied edit to %s: %v", name, role, err)
+			}
+		}
+	}
+}
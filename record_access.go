@@ -0,0 +1,136 @@
+package apimaker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// RecordRule authorizes access to single records. Check runs once the record
+// is loaded, in View, Edit, Delete and the history endpoints, and Scope adds
+// mandatory constraints to the filters of List and the change feed before the
+// model is queried. Either may be nil.
+type RecordRule struct {
+	Check func(c Context, operation Operation, model Model) (bool, error)
+	Scope func(c Context) (map[string]interface{}, error)
+	// DenyStatus answers denied records, http.StatusNotFound by default so
+	// that their existence is not revealed, or http.StatusForbidden.
+	DenyStatus int
+}
+
+// Apply enforces the rule on every operation of service.
+func (r RecordRule) Apply(service *APIService) *APIService {
+	return service.Use(AccessControl(InterceptorFunc(func(s *State, stage string, next func() error) error {
+		if err := next(); err != nil {
+			return err
+		}
+
+		switch stage {
+		case StageFetch:
+			if r.Check == nil {
+				return nil
+			}
+
+			// the delete operation only loads the model when it is needed
+			if err := s.fetch(); err != nil {
+				return NewStageError(http.StatusBadRequest, err, fmt.Sprintf("cannot find any %s", s.Service.Name))
+			}
+
+			if allowed, err := r.Check(s.Context, s.Operation, s.Model); err != nil || !allowed {
+				if r.DenyStatus == http.StatusForbidden {
+					return NewStageError(http.StatusForbidden, err, "authorization failed")
+				}
+				return NewStageError(http.StatusNotFound, nil, fmt.Sprintf("cannot find any %s", s.Service.Name))
+			}
+		case StageFilter:
+			if r.Scope == nil {
+				return nil
+			}
+
+			constraints, err := r.Scope(s.Context)
+			if err != nil {
+				return NewStageError(http.StatusForbidden, err, "authorization failed")
+			}
+			if len(constraints) > 0 {
+				s.Filter = WithConstraints(s.Filter, constraints)
+			}
+		}
+		return nil
+	})))
+}
+
+// OwnedBy restricts the records of a service to those whose JSON field holds
+// the ID of the principal: others are not found, List only returns owned
+// records and Create sets the field. Principals with one of the bypass roles
+// access every record.
+func OwnedBy(field string, bypassRoles ...string) RecordRule {
+	bypass := func(c Context) bool {
+		return len(bypassRoles) > 0 && GetPrincipal(c).HasRole(bypassRoles...)
+	}
+
+	return RecordRule{
+		Check: func(c Context, operation Operation, model Model) (bool, error) {
+			if bypass(c) {
+				return true, nil
+			}
+
+			principal := GetPrincipal(c)
+			if principal == nil {
+				return false, errors.New("no principal")
+			}
+
+			value, err := toJSONValue(model)
+			if err != nil {
+				return false, err
+			}
+			values, _ := value.(map[string]interface{})
+			return values[field] != nil && fmt.Sprint(values[field]) == principal.ID, nil
+		},
+		Scope: func(c Context) (map[string]interface{}, error) {
+			if bypass(c) {
+				return nil, nil
+			}
+
+			principal := GetPrincipal(c)
+			if principal == nil {
+				return nil, errors.New("no principal")
+			}
+			return map[string]interface{}{field: principal.ID}, nil
+		},
+	}
+}
+
+// ApplyOwnership enforces OwnedBy on service and sets the owner of created
+// records. Edits keep the owner unless made by a bypass role.
+func ApplyOwnership(service *APIService, field string, bypassRoles ...string) *APIService {
+	OwnedBy(field, bypassRoles...).Apply(service)
+	return service.Use(ForOperations(After(StageBind, func(s *State) error {
+		principal := GetPrincipal(s.Context)
+		if principal == nil {
+			return NewStageError(http.StatusForbidden, errors.New("no principal"), "authorization failed")
+		}
+		if s.Operation == OperationEdit && len(bypassRoles) > 0 && principal.HasRole(bypassRoles...) {
+			return nil
+		}
+
+		if err := setModelField(s.Model, field, principal.ID); err != nil {
+			return NewStageError(http.StatusInternalServerError, err, fmt.Sprintf("cannot set owner of %s", s.Service.Name))
+		}
+		return nil
+	}), OperationCreate, OperationEdit))
+}
+
+// setModelField sets a JSON field of a struct model, or of a model decoding
+// its own JSON such as a declarative Record.
+func setModelField(model Model, field, value string) error {
+	if err := setJSONField(model, field, value); err == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(map[string]string{field: value})
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, model)
+}
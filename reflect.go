@@ -0,0 +1,140 @@
+package apimaker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// jsonField describes a struct field the way it appears in JSON output.
+type jsonField struct {
+	Name      string
+	OmitEmpty bool
+	Index     []int
+	Field     reflect.StructField
+}
+
+// JSONTyper is implemented by values whose JSON form is described by another
+// type than their own, such as the records of declarative resources. The
+// returned type is used to check field selections and to document the API.
+type JSONTyper interface {
+	JSONType() reflect.Type
+}
+
+// jsonType returns the type describing the JSON form of v.
+func jsonType(v interface{}) reflect.Type {
+	if typer, ok := v.(JSONTyper); ok {
+		return typer.JSONType()
+	}
+	return reflect.TypeOf(v)
+}
+
+// indirectType strips pointers from t.
+func indirectType(t reflect.Type) reflect.Type {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// jsonFields returns the exported fields of a struct type keyed by their json
+// names. Embedded structs without a json name are flattened like encoding/json does.
+func jsonFields(t reflect.Type) []jsonField {
+	t = indirectType(t)
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+
+	var fields []jsonField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(tag, ",")
+		if sf.Anonymous && name == "" && indirectType(sf.Type).Kind() == reflect.Struct {
+			for _, inner := range jsonFields(sf.Type) {
+				inner.Index = append([]int{i}, inner.Index...)
+				fields = append(fields, inner)
+			}
+			continue
+		}
+
+		if !sf.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = sf.Name
+		}
+
+		fields = append(fields, jsonField{
+			Name:      name,
+			OmitEmpty: strings.Contains(opts, "omitempty"),
+			Index:     []int{i},
+			Field:     sf,
+		})
+	}
+
+	return fields
+}
+
+// lookupJSONField finds the field of t whose json name is name.
+func lookupJSONField(t reflect.Type, name string) (jsonField, bool) {
+	for _, f := range jsonFields(t) {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return jsonField{}, false
+}
+
+// toJSONValue converts v into its generic JSON form (maps, slices and scalars)
+// so it can be reshaped before being written to the response.
+func toJSONValue(v interface{}) (interface{}, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var out interface{}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// setJSONField sets the field of model whose json name is name from the
+// string form of a value, as found in route parameters.
+func setJSONField(model interface{}, name string, value string) error {
+	v := reflect.ValueOf(model)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("cannot set field %q on non-pointer model", name)
+	}
+
+	f, ok := lookupJSONField(v.Type(), name)
+	if !ok {
+		return fmt.Errorf("unknown field %q", name)
+	}
+
+	field, err := v.Elem().FieldByIndexErr(f.Index)
+	if err != nil {
+		return err
+	}
+
+	// strings and text unmarshalers take the quoted form, numbers and booleans the raw one
+	quoted, _ := json.Marshal(value)
+	target := field.Addr().Interface()
+	if err := json.Unmarshal(quoted, target); err != nil {
+		if err := json.Unmarshal([]byte(value), target); err != nil {
+			return fmt.Errorf("cannot set field %q: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+package apimaker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Relation declares that a resource references another registered APIService.
+// Clients can embed the related records with include=<Name> on View and List.
+type Relation struct {
+	// Name is the include name and the key the related record is embedded under.
+	Name string
+	// ForeignKey is the json name of the model field holding the related id,
+	// or a list of related ids.
+	ForeignKey string
+	// Service is the related resource; its NewModel is used to load records.
+	Service *APIService
+}
+
+// BatchGetter is implemented by models that can load several records in one
+// call. Ids are passed in the string form GetOne receives them in and the
+// result is keyed the same way; missing records are simply left out.
+type BatchGetter interface {
+	GetMany(ids []string) (map[string]interface{}, error)
+}
+
+// AddRelation declares a relation to another resource and returns the service
+// so calls can be chained.
+func (a *APIService) AddRelation(relation Relation) *APIService {
+	a.Relations = append(a.Relations, relation)
+	return a
+}
+
+// ParseIncludes reads the comma separated "include" query parameter.
+func ParseIncludes(c Context) []string {
+	return queryList(c, "include")
+}
+
+// lookupRelations resolves include names to the declared relations.
+func (a *APIService) lookupRelations(names []string) ([]Relation, error) {
+	var relations []Relation
+	for _, name := range names {
+		found := false
+		for _, relation := range a.Relations {
+			if relation.Name == name {
+				relations = append(relations, relation)
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return nil, fmt.Errorf("unknown include %q", name)
+		}
+	}
+	return relations, nil
+}
+
+// embedRelations loads the related records referenced by a generic JSON value
+// (a single object or a list of objects) and embeds them under each relation
+// name. Records of one relation are loaded in a single batch.
+func embedRelations(c Context, value interface{}, relations []Relation) error {
+	var objects []map[string]interface{}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		objects = append(objects, v)
+	case []interface{}:
+		for _, item := range v {
+			if object, ok := item.(map[string]interface{}); ok {
+				objects = append(objects, object)
+			}
+		}
+	}
+
+	for _, relation := range relations {
+		var ids []string
+		seen := map[string]bool{}
+		for _, object := range objects {
+			for _, id := range foreignKeys(object[relation.ForeignKey]) {
+				if !seen[id] {
+					seen[id] = true
+					ids = append(ids, id)
+				}
+			}
+		}
+
+		records, err := relation.load(c, ids)
+		if err != nil {
+			return err
+		}
+
+		for _, object := range objects {
+			switch key := object[relation.ForeignKey].(type) {
+			case []interface{}:
+				related := make([]interface{}, 0, len(key))
+				for _, id := range foreignKeys(key) {
+					if record, ok := records[id]; ok {
+						related = append(related, record)
+					}
+				}
+				object[relation.Name] = related
+			case nil:
+				object[relation.Name] = nil
+			default:
+				object[relation.Name] = records[fmt.Sprint(key)]
+			}
+		}
+	}
+	return nil
+}
+
+// foreignKeys returns the ids held by a foreign key value in string form.
+func foreignKeys(value interface{}) []string {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		var ids []string
+		for _, item := range v {
+			ids = append(ids, foreignKeys(item)...)
+		}
+		return ids
+	case map[string]interface{}:
+		return nil
+	default:
+		if id := fmt.Sprint(v); id != "" {
+			return []string{id}
+		}
+		return nil
+	}
+}
+
+// load fetches the related records by id, rendered for the current principal.
+// The records go through the View security of the related service and its
+// interceptors marked with AccessControl, such as record rules and tenancy:
+// nothing is embedded when the principal may not view the resource, and
+// records it does not find for the principal are left out. Its other
+// interceptors, such as rate limits and audits, are left to the request.
+func (relation Relation) load(c Context, ids []string) (map[string]interface{}, error) {
+	records := map[string]interface{}{}
+	if len(ids) == 0 {
+		return records, nil
+	}
+
+	service := relation.Service
+	if service == nil || service.NewModel == nil {
+		return nil, fmt.Errorf("relation %q has no service model", relation.Name)
+	}
+	if !service.config.Enabled(OperationView) {
+		return records, nil
+	}
+
+	// the stages of the related service must not leak into the request
+	for _, key := range []string{principalKey, tenantKey, operationKey, apiKeyKey} {
+		defer c.Set(key, c.Get(key))
+	}
+
+	defaults := service.config.resolve(OperationView)
+	chain := accessControls(service.chain(defaults.interceptors))
+	state := &State{Operation: OperationView, Service: service, Context: c, Security: defaults.security}
+	if err := service.runChain(state, []Stage{authenticateStage(), authorizeStage()}, chain); err != nil {
+		return records, relationError(err)
+	}
+
+	var found map[string]interface{}
+	if batch, ok := service.NewModel().(BatchGetter); ok {
+		var err error
+		if found, err = batch.GetMany(ids); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, id := range ids {
+		record := &State{Operation: OperationView, Service: state.Service, Context: c, Security: state.Security, Model: service.NewModel(), ID: id}
+		if found != nil {
+			value, ok := found[id]
+			if !ok {
+				continue
+			}
+			data, err := json.Marshal(value)
+			if err != nil {
+				return nil, err
+			}
+			if err := json.Unmarshal(data, record.Model); err != nil {
+				return nil, err
+			}
+			record.fetched = true
+		}
+
+		if err := service.runChain(record, []Stage{fetchStage()}, chain); err != nil {
+			if err = relationError(err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		rendered, err := service.renderValue(c, record.Model, record.Model, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		records[id] = rendered
+	}
+	return records, nil
+}
+
+// relationError drops the refusals of the related service, which leave the
+// records out, and returns its failures.
+func relationError(err error) error {
+	var stageErr *StageError
+	if errors.As(err, &stageErr) && stageErr.Code >= http.StatusInternalServerError {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package apimaker
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+// userSecurity authenticates the user named by the X-User header.
+func userSecurity() Security {
+	return Security{Authenticator: func(c Context) (bool, error) {
+		user := c.Request().Header.Get("X-User")
+		if user == "" {
+			return false, errors.New("no user")
+		}
+		SetPrincipal(c, &Principal{ID: user})
+		return true, nil
+	}}
+}
+
+func TestIncludeHonoursRelatedRecordRules(t *testing.T) {
+	mux := http.NewServeMux()
+	storeStore, itemStore := newTestStore(), newTestStore()
+	stores := newTestService(mux, "store", storeStore)
+	stores.Configure().WithSecurity(userSecurity())
+	OwnedBy("owner").Apply(stores)
+
+	items := newTestService(mux, "item", itemStore)
+	items.AddRelation(Relation{Name: "store", ForeignKey: "store_id", Service: stores})
+	if err := ViewApi(*items, itemStore.model(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, owner := range []string{"alice", "bob"} {
+		record := storeStore.model()
+		record.Owner = owner
+		if err := record.Save(); err != nil {
+			t.Fatal(err)
+		}
+		item := itemStore.model()
+		item.StoreID = record.ID
+		if err := item.Save(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	embedded := func(path string, header http.Header) interface{} {
+		t.Helper()
+		w := serve(mux, http.MethodGet, path, "", header)
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s = %d: %s", path, w.Code, w.Body)
+		}
+		var resp struct {
+			Data struct {
+				Item map[string]interface{} `json:"item"`
+			} `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp.Data.Item["store"]
+	}
+
+	alice := http.Header{"X-User": {"alice"}}
+	if store, _ := embedded("/item/view/1?include=store", alice).(map[string]interface{}); store["owner"] != "alice" {
+		t.Errorf("own store not embedded: %v", store)
+	}
+	if store := embedded("/item/view/2?include=store", alice); store != nil {
+		t.Errorf("store of another owner embedded: %v", store)
+	}
+	if store := embedded("/item/view/1?include=store", nil); store != nil {
+		t.Errorf("store embedded without authentication: %v", store)
+	}
+}
+
+func TestIncludeSkipsRelatedInterceptors(t *testing.T) {
+	mux := http.NewServeMux()
+	storeStore, itemStore := newTestStore(), newTestStore()
+	stores := newTestService(mux, "store", storeStore)
+	stores.Configure().WithSecurity(userSecurity())
+	OwnedBy("owner").Apply(stores)
+	stages := 0
+	stores.Use(Before(StageFetch, func(s *State) error {
+		stages++
+		return nil
+	}))
+
+	items := newTestService(mux, "item", itemStore)
+	items.AddRelation(Relation{Name: "store", ForeignKey: "store_id", Service: stores})
+	if err := ListApi(*items, itemStore.model(), new(testItemFilter)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, owner := range []string{"alice", "bob"} {
+		record := storeStore.model()
+		record.Owner = owner
+		if err := record.Save(); err != nil {
+			t.Fatal(err)
+		}
+		item := itemStore.model()
+		item.StoreID = record.ID
+		if err := item.Save(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	w := serve(mux, http.MethodGet, "/item/list?include=store", "", http.Header{"X-User": {"alice"}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("list = %d: %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Data struct {
+			Items []map[string]interface{} `json:"items"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+
+	if stages != 0 {
+		t.Errorf("interceptor of the related service ran %d times", stages)
+	}
+	if len(resp.Data.Items) != 2 || resp.Data.Items[0]["store"] == nil || resp.Data.Items[1]["store"] != nil {
+		t.Errorf("items = %v, want the store of alice only", resp.Data.Items)
+	}
+}
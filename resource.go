@@ -0,0 +1,247 @@
+package apimaker
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+)
+
+// ErrOperationDisabled is returned when registering an operation the
+// ResourceConfig of the service does not enable.
+var ErrOperationDisabled = errors.New("operation disabled")
+
+// defaultRoutes are the methods and paths of the operations, relative to the
+// routes of the service.
+var defaultRoutes = map[Operation][2]string{
+	OperationCreate: {http.MethodPost, "/create"},
+	OperationEdit:   {http.MethodPut, "/update/:id"},
+	OperationView:   {http.MethodGet, "/view/:id"},
+	OperationList:   {http.MethodGet, "/list"},
+	OperationDelete: {http.MethodDelete, "/delete/:id"},
+}
+
+// Hooks are the functions run by the hook stages; each only runs in the
+// operations having its stage.
+type Hooks struct {
+	BeforeSave   CreateFunc
+	AfterSave    CreateFunc
+	AfterFind    CreateFunc
+	BeforeList   CreateFunc
+	AfterList    CreateFunc
+	BeforeRemove CreateFunc
+	AfterRemove  CreateFunc
+}
+
+// merge returns h with the hooks it lacks taken from defaults.
+func (h Hooks) merge(defaults Hooks) Hooks {
+	pick := func(hook, fallback CreateFunc) CreateFunc {
+		if hook.set() {
+			return hook
+		}
+		return fallback
+	}
+	return Hooks{
+		BeforeSave:   pick(h.BeforeSave, defaults.BeforeSave),
+		AfterSave:    pick(h.AfterSave, defaults.AfterSave),
+		AfterFind:    pick(h.AfterFind, defaults.AfterFind),
+		BeforeList:   pick(h.BeforeList, defaults.BeforeList),
+		AfterList:    pick(h.AfterList, defaults.AfterList),
+		BeforeRemove: pick(h.BeforeRemove, defaults.BeforeRemove),
+		AfterRemove:  pick(h.AfterRemove, defaults.AfterRemove),
+	}
+}
+
+// OperationConfig overrides the ResourceConfig for one operation. Zero fields
+// keep the defaults of the resource.
+type OperationConfig struct {
+	Security *Security
+	Hooks    Hooks
+	// Method and Path replace the route of the operation, e.g. PATCH and
+	// "/:id" for Edit.
+	Method string
+	Path   string
+	// Interceptors are added after those of the resource.
+	Interceptors []Interceptor
+}
+
+// ResourceConfig holds the defaults of the operations of a service, returned
+// by APIService.Configure. Every way of running an operation uses it: the
+// Security and hooks of a ServiceRequest are only taken from it when the
+// request leaves them empty, disabled operations answer 405 and are not
+// registered, the easyuse helpers and declarative resources register the
+// configured routes, and the history, feed, audit, webhook and API key
+// endpoints fall back to its Security.
+type ResourceConfig struct {
+	mu           sync.RWMutex
+	security     Security
+	hooks        Hooks
+	pagination   PaginationPolicy
+	interceptors []Interceptor
+	operations   map[Operation]bool
+	overrides    map[Operation]OperationConfig
+	dependencies map[reflect.Type]interface{}
+}
+
+// Configure returns the configuration shared by the copies of the service.
+func (a *APIService) Configure() *ResourceConfig {
+	if a.config == nil {
+		a.config = &ResourceConfig{}
+	}
+	return a.config
+}
+
+// WithSecurity sets the default Security of every operation.
+func (r *ResourceConfig) WithSecurity(security Security) *ResourceConfig {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.security = security
+	return r
+}
+
+// WithHooks sets the default hooks.
+func (r *ResourceConfig) WithHooks(hooks Hooks) *ResourceConfig {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hooks = hooks
+	return r
+}
+
+// WithPagination sets the pagination policy of List.
+func (r *ResourceConfig) WithPagination(policy PaginationPolicy) *ResourceConfig {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pagination = policy
+	return r
+}
+
+// WithInterceptors adds interceptors to every operation run with the
+// configuration, inside those of the service.
+func (r *ResourceConfig) WithInterceptors(interceptors ...Interceptor) *ResourceConfig {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.interceptors = append(r.interceptors, interceptors...)
+	return r
+}
+
+// Enable restricts the resource to the given operations; every operation is
+// enabled until it is called.
+func (r *ResourceConfig) Enable(operations ...Operation) *ResourceConfig {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.operations = map[Operation]bool{}
+	for _, operation := range operations {
+		r.operations[operation] = true
+	}
+	return r
+}
+
+// Override sets the overrides of an operation.
+func (r *ResourceConfig) Override(operation Operation, config OperationConfig) *ResourceConfig {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.overrides == nil {
+		r.overrides = map[Operation]OperationConfig{}
+	}
+	r.overrides[operation] = config
+	return r
+}
+
+// Enabled reports whether operation is enabled.
+func (r *ResourceConfig) Enabled(operation Operation) bool {
+	if r == nil {
+		return true
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.operations == nil || r.operations[operation]
+}
+
+// Route returns the method and path of an operation, relative to the routes
+// of the service.
+func (r *ResourceConfig) Route(operation Operation) (string, string) {
+	route := defaultRoutes[operation]
+	if r == nil {
+		return route[0], route[1]
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	override := r.overrides[operation]
+	if override.Method != "" {
+		route[0] = override.Method
+	}
+	if override.Path != "" {
+		route[1] = override.Path
+	}
+	return route[0], route[1]
+}
+
+// operationDefaults are the settings of one operation, resolved from a
+// ResourceConfig.
+type operationDefaults struct {
+	security     Security
+	hooks        Hooks
+	pagination   PaginationPolicy
+	interceptors []Interceptor
+}
+
+func (r *ResourceConfig) resolve(operation Operation) operationDefaults {
+	if r == nil {
+		return operationDefaults{}
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	override := r.overrides[operation]
+	defaults := operationDefaults{
+		security:     r.security,
+		hooks:        override.Hooks.merge(r.hooks),
+		pagination:   r.pagination,
+		interceptors: append(append([]Interceptor(nil), r.interceptors...), override.Interceptors...),
+	}
+	if override.Security != nil {
+		defaults.security = *override.Security
+	}
+	return defaults
+}
+
+// operationDefaults resolves the configuration of an operation for a
+// request, whose own Security, hooks and interceptors take precedence. It
+// answers 405 and returns false when the operation is disabled.
+func (a APIService) operationDefaults(c Context, operation Operation, request BaseServiceRequest, hooks Hooks) (operationDefaults, bool, error) {
+	if !a.config.Enabled(operation) {
+		err := fmt.Errorf("%s of %s: %w", operation, a.Name, ErrOperationDisabled)
+		return operationDefaults{}, false, a.ErrorResponse(c, http.StatusMethodNotAllowed, err, "operation not allowed")
+	}
+
+	defaults := a.config.resolve(operation)
+	if request.Security.set() {
+		defaults.security = request.Security
+	}
+	defaults.hooks = hooks.merge(defaults.hooks)
+	defaults.interceptors = append(defaults.interceptors, request.Interceptors...)
+	return defaults, true, nil
+}
+
+// securityFor returns security when it is set, and otherwise the Security the
+// ResourceConfig gives operation, for the endpoints registered outside the
+// ServiceRequests. It is resolved per request, like that of the operations.
+func (a APIService) securityFor(operation Operation, security Security) Security {
+	if security.set() {
+		return security
+	}
+	return a.config.resolve(operation).security
+}
+
+// operationRoute returns the configured route of an operation to register, or
+// ErrOperationDisabled.
+func (a APIService) operationRoute(operation Operation) (string, string, error) {
+	if !a.config.Enabled(operation) {
+		return "", "", fmt.Errorf("%s of %s: %w", operation, a.Name, ErrOperationDisabled)
+	}
+	method, path := a.config.Route(operation)
+	return method, path, nil
+}
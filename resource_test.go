@@ -0,0 +1,56 @@
+package apimaker
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestResourceConfigSecurityGuardsEveryEndpoint(t *testing.T) {
+	mux := http.NewServeMux()
+	store := newTestStore()
+	service := newTestService(mux, "item", store)
+	service.Configure().WithSecurity(Security{Authenticator: func(c Context) (bool, error) {
+		if c.Request().Header.Get("X-User") == "" {
+			return false, errors.New("no user")
+		}
+		return true, nil
+	}})
+
+	if err := ViewApi(*service, store.model(), nil); err != nil {
+		t.Fatal(err)
+	}
+	NewHistory(NewMemoryRevisionStore()).Register(service, Security{}, func(c Context) UpdateServiceRequest {
+		return UpdateServiceRequest{BaseServiceRequest: BaseServiceRequest{Context: c, Model: store.model()}, Form: new(testItemForm)}
+	})
+	NewChangeFeed(service, 10).Register(Security{}, nil)
+
+	item := store.model()
+	item.Title = "a"
+	if err := item.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"/item/view/1", "/item/history/1", "/item/feed"} {
+		if w := serve(mux, http.MethodGet, path, "", nil); w.Code != http.StatusUnauthorized {
+			t.Errorf("GET %s without a user = %d, want 401", path, w.Code)
+		}
+	}
+	if w := serve(mux, http.MethodGet, "/item/history/1", "", http.Header{"X-User": {"u"}}); w.Code != http.StatusOK {
+		t.Errorf("GET /item/history/1 with a user = %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestAdminEndpointsRefuseWithoutSecurity(t *testing.T) {
+	mux := http.NewServeMux()
+	service := NewWebhooks(NewMemoryWebhookStore()).Register(HTTPMux(mux, "", testValidator{}), Security{}, testValidator{})
+
+	if w := serve(mux, http.MethodGet, "/webhooks/subscriptions", "", nil); w.Code != http.StatusForbidden {
+		t.Errorf("webhooks without security = %d, want 403", w.Code)
+	}
+
+	service.Configure().WithSecurity(Security{Authorizer: func(c Context) (bool, error) { return true, nil }})
+	if w := serve(mux, http.MethodGet, "/webhooks/subscriptions", "", nil); w.Code != http.StatusOK {
+		t.Errorf("webhooks with the security of the config = %d: %s", w.Code, w.Body)
+	}
+}
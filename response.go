@@ -24,7 +24,7 @@ type (
 )
 
 // SuccessResponse handles sending success responses.
-func SuccessResponse(c echo.Context, code int, message string, data echo.Map, metaData MetaData) error {
+func SuccessResponse(c Context, code int, message string, data echo.Map, metaData MetaData) error {
 	resp := &Response{
 		Code:           code,
 		SuccessMessage: message,
@@ -35,9 +35,11 @@ func SuccessResponse(c echo.Context, code int, message string, data echo.Map, me
 }
 
 // ErrorResponse handles sending error responses.
-func (a *APIService) ErrorResponse(c echo.Context, code int, err error, message string) error {
+func (a *APIService) ErrorResponse(c Context, code int, err error, message string) error {
 
-	a.Logger.Errorf("%s: %v", message, err)
+	if a.Logger != nil {
+		a.Logger.Errorf("%s: %v", message, err)
+	}
 
 	resp := &Response{
 		Code:         code,
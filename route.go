@@ -0,0 +1,56 @@
+package apimaker
+
+import "sync"
+
+// Operation names one of the operations a resource supports.
+type Operation string
+
+const (
+	OperationCreate Operation = "create"
+	OperationEdit   Operation = "edit"
+	OperationView   Operation = "view"
+	OperationList   Operation = "list"
+	OperationDelete Operation = "delete"
+)
+
+// Route describes an endpoint registered for a resource. Routes are recorded
+// by the easyuse helpers and can be added with Describe for handlers written
+// by hand; they are used to document the API.
+type Route struct {
+	Operation Operation
+	Method    string
+	// Path is the full echo path, e.g. "/product/view/:id".
+	Path   string
+	Model  Model
+	Form   Form
+	Filter Filter
+}
+
+// routeRegistry is shared by copies of an APIService so that routes recorded
+// through a value copy are still visible on the original.
+type routeRegistry struct {
+	mu     sync.RWMutex
+	routes []Route
+}
+
+// Describe records a route of the service.
+func (a *APIService) Describe(route Route) {
+	if a.routes == nil {
+		a.routes = &routeRegistry{}
+	}
+
+	a.routes.mu.Lock()
+	defer a.routes.mu.Unlock()
+	a.routes.routes = append(a.routes.routes, route)
+}
+
+// Routes returns the routes recorded for the service.
+func (a *APIService) Routes() []Route {
+	if a.routes == nil {
+		return nil
+	}
+
+	a.routes.mu.RLock()
+	defer a.routes.mu.RUnlock()
+	return append([]Route(nil), a.routes.routes...)
+}
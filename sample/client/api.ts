@@ -0,0 +1,134 @@
+// Code generated by apimaker. DO NOT EDIT.
+
+/** Mirrors apimaker.MetaData. */
+export interface MetaData {
+  limit: number;
+  total_counts: number;
+  total_pages: number;
+  current_page: number;
+  next_page: number;
+  sort: string;
+}
+
+/** Mirrors apimaker.Pagination. */
+export interface Pagination {
+  limit: number;
+  page: number;
+  sort: string;
+  unlimited: string;
+}
+
+/** Mirrors product.Product. */
+export interface Product {
+  name: string;
+  price: number;
+}
+
+/** Mirrors product.AddProductForm. */
+export interface AddProductForm {
+  name: string;
+  price: number;
+}
+
+/** Mirrors product.ProductFilter. */
+export interface ProductFilter {
+  name: string;
+}
+
+/** The envelope every api_maker endpoint answers with. */
+export interface Response<T> {
+  code: number;
+  success_message: string;
+  error_message: string;
+  data: T;
+  metadata: MetaData;
+}
+
+/** Thrown when the API answers with an error response. */
+export class ApiError extends Error {
+  constructor(public readonly status: number, message: string) {
+    super(message);
+    this.name = "ApiError";
+  }
+}
+
+/** Query options of View and List requests. */
+export interface RequestOptions {
+  fields?: string[];
+  include?: string[];
+}
+
+type Query = Record<string, unknown>;
+
+export class Client {
+  constructor(
+    private readonly baseURL: string,
+    private readonly init: RequestInit = {},
+  ) {}
+
+  async request<T>(method: string, path: string, query?: Query, body?: unknown): Promise<Response<T>> {
+    const url = new URL(this.baseURL.replace(/\/$/, "") + path);
+    for (const [key, value] of Object.entries(query ?? {})) {
+      if (value === undefined || value === null || value === "") continue;
+      for (const item of Array.isArray(value) ? value : [value]) {
+        url.searchParams.append(key, String(item));
+      }
+    }
+
+    const headers = new Headers(this.init.headers);
+    if (body !== undefined) headers.set("Content-Type", "application/json");
+
+    const res = await fetch(url, {
+      ...this.init,
+      method,
+      headers,
+      body: body === undefined ? undefined : JSON.stringify(body),
+    });
+
+    let envelope: Response<T>;
+    try {
+      envelope = (await res.json()) as Response<T>;
+    } catch {
+      throw new ApiError(res.status, res.statusText);
+    }
+    if (!res.ok) throw new ApiError(res.status, envelope.error_message || res.statusText);
+    return envelope;
+  }
+}
+
+function renderOptions(options?: RequestOptions): Query {
+  return {
+    fields: options?.fields?.join(","),
+    include: options?.include?.join(","),
+  };
+}
+
+/** Calls the product resource. */
+export class ProductClient {
+  constructor(private readonly client: Client) {}
+
+  async create(form: AddProductForm): Promise<Product> {
+    const res = await this.client.request<{ "product": Product }>("POST", `/product/create`, undefined, form);
+    return res.data["product"];
+  }
+
+  async edit(id: string, form: AddProductForm): Promise<Product> {
+    const res = await this.client.request<{ "product": Product }>("PUT", `/product/edit/${encodeURIComponent(id)}`, undefined, form);
+    return res.data["product"];
+  }
+
+  async list(filter: Partial<ProductFilter> = {}, page: Partial<Pagination> = {}, options?: RequestOptions): Promise<{ items: Product[]; metadata: MetaData }> {
+    const query = { ...filter, ...page, ...renderOptions(options) } as Query;
+    const res = await this.client.request<{ "products": Product[] }>("GET", `/product/list`, query);
+    return { items: res.data["products"], metadata: res.metadata };
+  }
+
+  async view(id: string, options?: RequestOptions): Promise<Product> {
+    const res = await this.client.request<{ "product": Product }>("GET", `/product/view/${encodeURIComponent(id)}`, renderOptions(options));
+    return res.data["product"];
+  }
+
+  async delete(id: string): Promise<void> {
+    await this.client.request<null>("DELETE", `/product/delete/${encodeURIComponent(id)}`);
+  }
+}
@@ -0,0 +1,53 @@
+// Command gen writes the typed Go client and the TypeScript definitions of
+// the sample product API. It is run by go generate from the sample directory.
+package main
+
+import (
+	"flag"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/labstack/echo/v4"
+	apimaker "github.com/yasinsaee/api_maker"
+	"github.com/yasinsaee/api_maker/sample/product"
+)
+
+func main() {
+	out := flag.String("out", "client/client.go", "file the client is written to")
+	pkg := flag.String("pkg", "client", "package name of the client")
+	ts := flag.String("ts", "", "file the TypeScript client is written to, skipped when empty")
+	flag.Parse()
+
+	ec := echo.New()
+	apiService := apimaker.NewAPIService("product", ec.Group("/product"), nil, ec.Logger)
+	product.Describe(apiService)
+
+	write(*out, func(w io.Writer) error {
+		return apimaker.GenerateGoClient(w, *pkg, apiService)
+	})
+
+	if *ts != "" {
+		write(*ts, func(w io.Writer) error {
+			return apimaker.GenerateTypeScript(w, apiService)
+		})
+	}
+}
+
+// write creates the file at path and fills it with generate.
+func write(path string, generate func(w io.Writer) error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		log.Fatal(err)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := generate(f); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -1,6 +1,10 @@
+//go:generate go run ./gen -out client/client.go -pkg client -ts client/api.ts
+
 package main
 
 import (
+	_ "embed"
+
 	"github.com/go-playground/validator/v10"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
@@ -9,6 +13,9 @@ import (
 	"github.com/yasinsaee/api_maker/sample/product"
 )
 
+//go:embed countries.yaml
+var countries []byte
+
 func main() {
 	ec := echo.New()
 	ec.Validator = &apimaker.CustomValidator{Validator: validator.New()}
@@ -144,5 +151,27 @@ func main() {
 		return nil
 	})
 
+	// Describe the hand written routes so they show up in the OpenAPI document.
+	product.Describe(apiService)
+
+	// Register the resources declared in countries.yaml, backed by an in-memory store.
+	definitions, err := apimaker.ParseDefinitions(countries, "yaml")
+	if err != nil {
+		ec.Logger.Fatal(err)
+	}
+
+	declared, err := definitions.Register(apimaker.EchoMux(ec.Group("")), apimaker.DefinitionOptions{
+		Validator: ec.Validator,
+		Logger:    ec.Logger,
+	})
+	if err != nil {
+		ec.Logger.Fatal(err)
+	}
+
+	// Serves /openapi.json and the Swagger UI at /docs
+	apimaker.ServeOpenAPI(apimaker.EchoMux(ec.Group("")), apimaker.OpenAPIConfig{
+		Info: apimaker.OpenAPIInfo{Title: "Product API", Version: "1.0.0"},
+	}, append([]*apimaker.APIService{apiService}, declared...)...)
+
 	ec.Logger.Fatal(ec.Start(":1111"))
 }
@@ -11,7 +11,7 @@ package product
 
 // ProductFilter defines the fields by which products can be filtered.
 type ProductFilter struct {
-	Name string
+	Name string `query:"name"`
 }
 
 // GetFilters returns a map of filters to be used in queries.
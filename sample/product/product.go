@@ -49,6 +49,16 @@ func (p Product) List(filter apimaker.Filter, pagination apimaker.Pagination) (i
 	// Example: Retrieve a list of products from the database
 	// Return totalCounts, totalPages, list of products, and an error if any
 
+	// filter may wrap the ProductFilter with constraints set by the server,
+	// such as a parent or tenant; GetFilters includes them and UnwrapFilter
+	// returns the ProductFilter bound from the request
+	filters := filter.GetFilters()
+	if productFilter, ok := apimaker.UnwrapFilter(filter).(*ProductFilter); ok && productFilter.Name != "" {
+		// Example: match names by prefix instead of exactly
+		filters["name"] = map[string]interface{}{"$regex": "^" + productFilter.Name}
+	}
+	_ = filters // Example: query the database with filters
+
 	totalCounts := 0
 	totalPages := 0
 	products := []Product{}
@@ -0,0 +1,29 @@
+/*
+	@package   product
+	@version   1.0.0
+	@summary   Route descriptions for the product API
+	@details   Describes the hand written product routes so they can be documented and used by code generators.
+	@date      2024-06-03
+	@author    YasinSaee
+*/
+
+package product
+
+import (
+	"net/http"
+
+	apimaker "github.com/yasinsaee/api_maker"
+)
+
+// Describe records the product routes on the api service.
+func Describe(apiService *apimaker.APIService) {
+	for _, route := range []apimaker.Route{
+		{Operation: apimaker.OperationCreate, Method: http.MethodPost, Path: "/product/create", Model: new(Product), Form: new(AddProductForm)},
+		{Operation: apimaker.OperationEdit, Method: http.MethodPut, Path: "/product/edit/:id", Model: new(Product), Form: new(AddProductForm)},
+		{Operation: apimaker.OperationList, Method: http.MethodGet, Path: "/product/list", Model: new(Product), Filter: new(ProductFilter)},
+		{Operation: apimaker.OperationView, Method: http.MethodGet, Path: "/product/view/:id", Model: new(Product)},
+		{Operation: apimaker.OperationDelete, Method: http.MethodDelete, Path: "/product/delete/:id", Model: new(Product)},
+	} {
+		apiService.Describe(route)
+	}
+}
@@ -0,0 +1,257 @@
+package apimaker
+
+import (
+	"encoding"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schema is a JSON Schema object as used by OpenAPI 3.1.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty"`
+	Type                 interface{}        `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	ExclusiveMinimum     *float64           `json:"exclusiveMinimum,omitempty"`
+	ExclusiveMaximum     *float64           `json:"exclusiveMaximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+}
+
+// schemaRefPrefix is where component schemas live in an OpenAPI document.
+const schemaRefPrefix = "#/components/schemas/"
+
+// SchemaRegistry reflects Go types into JSON Schemas. Named struct types are
+// collected once under Schemas and referenced with $ref.
+type SchemaRegistry struct {
+	Schemas map[string]*Schema
+	names   map[reflect.Type]string
+}
+
+// NewSchemaRegistry creates an empty SchemaRegistry.
+func NewSchemaRegistry() *SchemaRegistry {
+	return &SchemaRegistry{
+		Schemas: map[string]*Schema{},
+		names:   map[reflect.Type]string{},
+	}
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// Ref returns a schema for t, registering named struct types as components.
+func (r *SchemaRegistry) Ref(t reflect.Type) *Schema {
+	t = indirectType(t)
+	if t == nil {
+		return &Schema{}
+	}
+
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType):
+		return &Schema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: r.Ref(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: r.Ref(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return r.structSchema(t)
+		}
+		return &Schema{Ref: schemaRefPrefix + r.register(t)}
+	}
+
+	// interfaces and anything else accept any value
+	return &Schema{}
+}
+
+// register adds a named struct type to the registry and returns its name.
+func (r *SchemaRegistry) register(t reflect.Type) string {
+	if name, ok := r.names[t]; ok {
+		return name
+	}
+
+	name := t.Name()
+	if _, taken := r.Schemas[name]; taken {
+		pkg := t.PkgPath()
+		name = strings.ReplaceAll(pkg[strings.LastIndex(pkg, "/")+1:], ".", "_") + "_" + name
+	}
+
+	// reserve the name first so recursive types resolve to a $ref
+	r.names[t] = name
+	r.Schemas[name] = &Schema{}
+	*r.Schemas[name] = *r.structSchema(t)
+	return name
+}
+
+// structSchema builds an inline object schema for a struct type, translating
+// validate tags into schema constraints.
+func (r *SchemaRegistry) structSchema(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	for _, f := range jsonFields(t) {
+		property := r.Ref(f.Field.Type)
+		if applyValidateTag(property, f.Field.Type, f.Field.Tag.Get("validate")) {
+			schema.Required = append(schema.Required, f.Name)
+		}
+
+		if access := parseAPITag(f.Field.Tag.Get("api")); len(access.Write) > 0 {
+			property.Description = "writable by: " + strings.Join(access.Write, ", ")
+		}
+		schema.Properties[f.Name] = property
+	}
+	return schema
+}
+
+// applyValidateTag translates go-playground validator rules into schema
+// constraints and reports whether the field is required. Rules after "dive"
+// apply to slice elements.
+func applyValidateTag(schema *Schema, t reflect.Type, tag string) bool {
+	if tag == "" || tag == "-" {
+		return false
+	}
+
+	t = indirectType(t)
+	required := false
+	rules := strings.Split(tag, ",")
+	for i, rule := range rules {
+		name, param, _ := strings.Cut(rule, "=")
+		switch name {
+		case "dive":
+			if schema.Items != nil {
+				applyValidateTag(schema.Items, t.Elem(), strings.Join(rules[i+1:], ","))
+			}
+			return required
+		case "required":
+			required = true
+		case "min", "gte":
+			setLowerBound(schema, t, param, false)
+		case "max", "lte":
+			setUpperBound(schema, t, param, false)
+		case "gt":
+			setLowerBound(schema, t, param, true)
+		case "lt":
+			setUpperBound(schema, t, param, true)
+		case "len":
+			setLowerBound(schema, t, param, false)
+			setUpperBound(schema, t, param, false)
+		case "oneof":
+			for _, option := range strings.Fields(param) {
+				schema.Enum = append(schema.Enum, enumValue(t, option))
+			}
+		case "email":
+			schema.Format = "email"
+		case "url", "uri":
+			schema.Format = "uri"
+		case "uuid", "uuid4":
+			schema.Format = "uuid"
+		case "datetime":
+			schema.Format = "date-time"
+		case "ip":
+			schema.Format = "ip"
+		case "ipv4", "ipv6", "hostname":
+			schema.Format = name
+		}
+	}
+	return required
+}
+
+func setLowerBound(schema *Schema, t reflect.Type, param string, exclusive bool) {
+	n, err := strconv.ParseFloat(param, 64)
+	if err != nil || t == nil {
+		return
+	}
+
+	switch {
+	case t.Kind() == reflect.String:
+		length := int(n)
+		if exclusive {
+			length++
+		}
+		schema.MinLength = &length
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map:
+		count := int(n)
+		if exclusive {
+			count++
+		}
+		schema.MinItems = &count
+	case exclusive:
+		schema.ExclusiveMinimum = &n
+	default:
+		schema.Minimum = &n
+	}
+}
+
+func setUpperBound(schema *Schema, t reflect.Type, param string, exclusive bool) {
+	n, err := strconv.ParseFloat(param, 64)
+	if err != nil || t == nil {
+		return
+	}
+
+	switch {
+	case t.Kind() == reflect.String:
+		length := int(n)
+		if exclusive {
+			length--
+		}
+		schema.MaxLength = &length
+	case t.Kind() == reflect.Slice || t.Kind() == reflect.Array || t.Kind() == reflect.Map:
+		count := int(n)
+		if exclusive {
+			count--
+		}
+		schema.MaxItems = &count
+	case exclusive:
+		schema.ExclusiveMaximum = &n
+	default:
+		schema.Maximum = &n
+	}
+}
+
+// enumValue converts a oneof option to the JSON type of the field.
+func enumValue(t reflect.Type, option string) interface{} {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if n, err := strconv.ParseInt(option, 10, 64); err == nil {
+			return n
+		}
+	case reflect.Float32, reflect.Float64:
+		if n, err := strconv.ParseFloat(option, 64); err == nil {
+			return n
+		}
+	}
+	return option
+}
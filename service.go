@@ -1,12 +1,14 @@
 package apimaker
 
-import "github.com/labstack/echo/v4"
-
 // BaseServiceRequest defines common fields for all service requests.
+// Interceptors only wrap the stages of this request. An empty Security, like
+// the hooks left unset in the requests, is taken from the ResourceConfig of
+// the service.
 type BaseServiceRequest struct {
-	Context  echo.Context
-	Model    Model
-	Security Security
+	Context      Context
+	Model        Model
+	Security     Security
+	Interceptors []Interceptor
 }
 
 // CreateServiceRequest defines the structure for a service request used for creating resources.
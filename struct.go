@@ -3,11 +3,17 @@ package apimaker
 import (
 	"encoding/json"
 	"errors"
-
-	"github.com/labstack/echo/v4"
+	"reflect"
 )
 
-func BindStruct(g echo.Context, form interface{}, model interface{}) error {
+func BindStruct(g Context, form interface{}, model interface{}) error {
+	return BindStructWithPolicy(g, form, model, WriteIgnore)
+}
+
+// BindStructWithPolicy binds and validates the form and copies it onto the
+// model. Fields the current principal may not write, according to the api tags
+// of the form and the model, are handled as described by policy.
+func BindStructWithPolicy(g Context, form interface{}, model interface{}, policy WritePolicy) error {
 	if err := g.Bind(form); err != nil {
 		return errors.New("error in bind form")
 	}
@@ -16,7 +22,27 @@ func BindStruct(g echo.Context, form interface{}, model interface{}) error {
 		return errors.New("error in validation form, error : " + err.Error())
 	}
 
-	jsonString, err := json.Marshal(form)
+	value, err := toJSONValue(form)
+	if err != nil {
+		return err
+	}
+
+	if values, ok := value.(map[string]interface{}); ok {
+		principal := GetPrincipal(g)
+		denied := unwritableFields(values, reflect.TypeOf(form), principal, "")
+		denied = append(denied, unwritableFields(values, reflect.TypeOf(model), principal, "")...)
+
+		for _, path := range denied {
+			if policy == WriteReject {
+				if field, _ := lookupPath(values, path); !isZeroJSON(field) {
+					return &FieldPermissionError{Field: path}
+				}
+			}
+			deletePath(values, path)
+		}
+	}
+
+	jsonString, err := json.Marshal(value)
 	if err != nil {
 		return err
 	}
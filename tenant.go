@@ -0,0 +1,220 @@
+package apimaker
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// tenantKey is the context key the tenant of the request is stored under.
+const tenantKey = "apimaker.tenant"
+
+// SetTenant stores the tenant of the request in the context.
+func SetTenant(c Context, tenant string) {
+	c.Set(tenantKey, tenant)
+}
+
+// GetTenant returns the tenant of the request, or "" when none was resolved.
+func GetTenant(c Context) string {
+	tenant, _ := c.Get(tenantKey).(string)
+	return tenant
+}
+
+// TenantResolver returns the tenant of a request, or "" when the request does
+// not name one.
+type TenantResolver func(c Context) (string, error)
+
+// TenantFromHeader reads the tenant from a request header.
+func TenantFromHeader(name string) TenantResolver {
+	return func(c Context) (string, error) {
+		return strings.TrimSpace(c.Request().Header.Get(name)), nil
+	}
+}
+
+// TenantFromSubdomain reads the tenant from the subdomain of domain the
+// request is addressed to, "acme" for acme.example.com and domain example.com.
+func TenantFromSubdomain(domain string) TenantResolver {
+	suffix := "." + strings.ToLower(strings.Trim(domain, "."))
+	return func(c Context) (string, error) {
+		host := strings.ToLower(c.Request().Host)
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+
+		tenant, found := strings.CutSuffix(host, suffix)
+		if !found || tenant == "" {
+			return "", nil
+		}
+		if strings.Contains(tenant, ".") {
+			return "", fmt.Errorf("invalid tenant subdomain %q", tenant)
+		}
+		return tenant, nil
+	}
+}
+
+// TenantFromPath reads the tenant from the path segment following prefix,
+// "acme" for /tenants/acme/product/list and prefix /tenants. The routes must
+// be registered below the prefix, for example on a group with a parameter.
+func TenantFromPath(prefix string) TenantResolver {
+	prefix = "/" + strings.Trim(prefix, "/")
+	if prefix == "/" {
+		prefix = ""
+	}
+	return func(c Context) (string, error) {
+		rest, found := strings.CutPrefix(c.Request().URL.Path, prefix+"/")
+		if !found {
+			return "", nil
+		}
+		tenant, _, _ := strings.Cut(rest, "/")
+		return tenant, nil
+	}
+}
+
+// TenantFromClaim reads the tenant from a string claim of the principal, so it
+// needs an authenticator setting claims such as JWTAuthenticator.
+func TenantFromClaim(claim string) TenantResolver {
+	return func(c Context) (string, error) {
+		principal := GetPrincipal(c)
+		if principal == nil {
+			return "", nil
+		}
+		tenant, _ := principal.Claims[claim].(string)
+		return tenant, nil
+	}
+}
+
+// FirstTenant tries resolvers in order and returns the first tenant found.
+func FirstTenant(resolvers ...TenantResolver) TenantResolver {
+	return func(c Context) (string, error) {
+		for _, resolve := range resolvers {
+			tenant, err := resolve(c)
+			if err != nil || tenant != "" {
+				return tenant, err
+			}
+		}
+		return "", nil
+	}
+}
+
+// TenantConfig overrides the settings of a service for one tenant.
+type TenantConfig struct {
+	// WritePolicy replaces the WritePolicy of the service.
+	WritePolicy *WritePolicy
+	// MaxLimit caps the page size of List, including unlimited requests.
+	MaxLimit int
+	// Settings holds application settings for hooks, read with
+	// APIService.TenantConfig.
+	Settings map[string]interface{}
+}
+
+// tenantRegistry is shared by copies of an APIService, like routeRegistry.
+type tenantRegistry struct {
+	mu      sync.RWMutex
+	configs map[string]TenantConfig
+}
+
+// ConfigureTenant sets the overrides of a tenant.
+func (a *APIService) ConfigureTenant(tenant string, config TenantConfig) *APIService {
+	if a.tenants == nil {
+		a.tenants = &tenantRegistry{}
+	}
+
+	a.tenants.mu.Lock()
+	defer a.tenants.mu.Unlock()
+	if a.tenants.configs == nil {
+		a.tenants.configs = map[string]TenantConfig{}
+	}
+	a.tenants.configs[tenant] = config
+	return a
+}
+
+// TenantConfig returns the overrides of a tenant.
+func (a *APIService) TenantConfig(tenant string) (TenantConfig, bool) {
+	if a.tenants == nil {
+		return TenantConfig{}, false
+	}
+
+	a.tenants.mu.RLock()
+	defer a.tenants.mu.RUnlock()
+	config, ok := a.tenants.configs[tenant]
+	return config, ok
+}
+
+// Tenancy isolates the records of the tenants of a service. Each record holds
+// its tenant in the JSON field Field.
+type Tenancy struct {
+	Field    string
+	Resolver TenantResolver
+	// Allow, when set, checks that the principal belongs to the resolved
+	// tenant; it is needed when clients choose the tenant, as with
+	// TenantFromHeader.
+	Allow func(c Context, tenant string) (bool, error)
+}
+
+// NewTenancy creates a Tenancy storing the tenant in field.
+func NewTenancy(field string, resolver TenantResolver) *Tenancy {
+	return &Tenancy{Field: field, Resolver: resolver}
+}
+
+// Apply makes every operation of service tenant aware. Once the request is
+// authenticated the tenant is resolved, checked with Allow and stored in the
+// context, and the overrides of the tenant are applied; requests without a
+// tenant fail with 400. List and the change feed only return the records of
+// the tenant, Create and Edit set the tenant field, and records of other
+// tenants are not found by View, Edit, Delete and the history endpoints.
+func (t *Tenancy) Apply(service *APIService) *APIService {
+	service.Use(AccessControl(After(StageAuthenticate, func(s *State) error {
+		tenant, err := t.Resolver(s.Context)
+		if err != nil {
+			return NewStageError(http.StatusBadRequest, err, "invalid tenant")
+		}
+		if tenant == "" {
+			return NewStageError(http.StatusBadRequest, errors.New("missing tenant"), "invalid tenant")
+		}
+
+		if t.Allow != nil {
+			if allowed, err := t.Allow(s.Context, tenant); err != nil || !allowed {
+				return NewStageError(http.StatusForbidden, err, "authorization failed")
+			}
+		}
+		SetTenant(s.Context, tenant)
+
+		if config, ok := s.Service.TenantConfig(tenant); ok {
+			// the service may be shared by concurrent requests
+			overridden := *s.Service
+			if config.WritePolicy != nil {
+				overridden.WritePolicy = *config.WritePolicy
+			}
+			s.Service = &overridden
+
+			if config.MaxLimit > 0 && (s.Pagination.Limit < 0 || s.Pagination.Limit > config.MaxLimit) {
+				s.Pagination.Limit = config.MaxLimit
+			}
+		}
+		return nil
+	})))
+
+	RecordRule{
+		Check: func(c Context, operation Operation, model Model) (bool, error) {
+			value, err := toJSONValue(model)
+			if err != nil {
+				return false, err
+			}
+			values, _ := value.(map[string]interface{})
+			return values[t.Field] != nil && fmt.Sprint(values[t.Field]) == GetTenant(c), nil
+		},
+		Scope: func(c Context) (map[string]interface{}, error) {
+			return map[string]interface{}{t.Field: GetTenant(c)}, nil
+		},
+	}.Apply(service)
+
+	return service.Use(ForOperations(After(StageBind, func(s *State) error {
+		if err := setModelField(s.Model, t.Field, GetTenant(s.Context)); err != nil {
+			return NewStageError(http.StatusInternalServerError, err, fmt.Sprintf("cannot set tenant of %s", s.Service.Name))
+		}
+		return nil
+	}), OperationCreate, OperationEdit))
+}
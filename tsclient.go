@@ -0,0 +1,319 @@
+package apimaker
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"text/template"
+)
+
+// GenerateTypeScript writes TypeScript interfaces for the forms, filters and
+// models of the given services, the Response/MetaData envelope and a
+// fetch-based client per resource. Fields follow their json tags; omitempty
+// and pointer fields become optional unless the validate tag requires them.
+func GenerateTypeScript(w io.Writer, services ...*APIService) error {
+	types := newTSTypeWriter()
+	types.typeExpr(reflect.TypeOf(MetaData{}))
+	types.typeExpr(reflect.TypeOf(Pagination{}))
+
+	var resources []tsResource
+	for _, service := range services {
+		resource := tsResource{
+			Name: exportName(service.Name),
+			Key:  service.Name,
+		}
+
+		seen := map[Operation]bool{}
+		for _, route := range service.Routes() {
+			if seen[route.Operation] {
+				continue
+			}
+			seen[route.Operation] = true
+
+			method := tsMethod{
+				Operation: string(route.Operation),
+				Method:    route.Method,
+				Model:     types.typeExpr(indirectType(jsonType(route.Model))),
+			}
+			method.Path, method.Params = tsClientPath(route.Path)
+			if route.Form != nil {
+				method.Form = types.typeExpr(indirectType(jsonType(route.Form)))
+			}
+			if route.Filter != nil {
+				method.Filter = types.typeExpr(indirectType(jsonType(route.Filter)))
+			}
+			resource.Methods = append(resource.Methods, method)
+		}
+		resources = append(resources, resource)
+	}
+
+	var src bytes.Buffer
+	if err := tsTemplate.Execute(&src, map[string]interface{}{
+		"Types":     types.declarations(),
+		"Resources": resources,
+	}); err != nil {
+		return err
+	}
+
+	_, err := w.Write(src.Bytes())
+	return err
+}
+
+type tsResource struct {
+	Name    string
+	Key     string
+	Methods []tsMethod
+}
+
+type tsMethod struct {
+	Operation string
+	Method    string
+	// Path is a template literal building the request path from Params.
+	Path   string
+	Params []string
+	Model  string
+	Form   string
+	Filter string
+}
+
+// tsClientPath turns an echo path into a TypeScript template literal and the
+// names of its parameters.
+func tsClientPath(path string) (string, []string) {
+	var params []string
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			name := goIdent(segment[1:])
+			params = append(params, name)
+			segments[i] = "${encodeURIComponent(" + name + ")}"
+		}
+	}
+	return "`" + strings.Join(segments, "/") + "`", params
+}
+
+// tsTypeWriter reflects Go types into TypeScript interfaces.
+type tsTypeWriter struct {
+	names map[reflect.Type]string
+	taken map[string]bool
+	order []reflect.Type
+}
+
+func newTSTypeWriter() *tsTypeWriter {
+	return &tsTypeWriter{
+		names: map[reflect.Type]string{},
+		taken: map[string]bool{"Response": true, "ApiError": true, "RequestOptions": true},
+	}
+}
+
+// typeExpr returns the TypeScript type of t, declaring named struct types.
+func (w *tsTypeWriter) typeExpr(t reflect.Type) string {
+	if t == nil {
+		return "unknown"
+	}
+
+	switch {
+	case t.Kind() == reflect.Ptr:
+		return w.typeExpr(t.Elem()) + " | null"
+	case t == timeType:
+		return "string"
+	case t.Implements(jsonMarshalerType) || reflect.PointerTo(t).Implements(jsonMarshalerType):
+		return "unknown"
+	case t.Implements(textMarshalerType) || reflect.PointerTo(t).Implements(textMarshalerType):
+		return "string"
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.String:
+		return "string"
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "string"
+		}
+		elem := w.typeExpr(t.Elem())
+		if strings.Contains(elem, " ") {
+			elem = "(" + elem + ")"
+		}
+		return elem + "[]"
+	case reflect.Map:
+		return "Record<string, " + w.typeExpr(t.Elem()) + ">"
+	case reflect.Struct:
+		if t.Name() == "" {
+			return "{\n" + w.fields(t, "  ") + "}"
+		}
+		return w.declare(t)
+	}
+	return "unknown"
+}
+
+func (w *tsTypeWriter) declare(t reflect.Type) string {
+	if name, ok := w.names[t]; ok {
+		return name
+	}
+
+	name := t.Name()
+	if w.taken[name] {
+		pkg := t.PkgPath()
+		name = exportName(pkg[strings.LastIndex(pkg, "/")+1:]) + name
+	}
+	w.taken[name] = true
+	w.names[t] = name
+	w.order = append(w.order, t)
+	return name
+}
+
+// fields renders the properties of a struct type. Query tagged fields use
+// their query name, so filters and pagination describe the query string.
+func (w *tsTypeWriter) fields(t reflect.Type, indent string) string {
+	var b strings.Builder
+	for _, f := range jsonFields(t) {
+		name := f.Name
+		if query := f.Field.Tag.Get("query"); query != "" {
+			name = query
+		}
+
+		optional := f.OmitEmpty || f.Field.Type.Kind() == reflect.Ptr
+		if tag := f.Field.Tag.Get("validate"); tag != "" {
+			for _, rule := range strings.Split(tag, ",") {
+				if rule == "required" {
+					optional = false
+				}
+			}
+		}
+
+		marker := ""
+		if optional {
+			marker = "?"
+		}
+		fmt.Fprintf(&b, "%s%s%s: %s;\n", indent, tsPropertyName(name), marker, w.typeExpr(f.Field.Type))
+	}
+	return b.String()
+}
+
+func (w *tsTypeWriter) declarations() string {
+	var b strings.Builder
+	for i := 0; i < len(w.order); i++ {
+		t := w.order[i]
+		fmt.Fprintf(&b, "/** Mirrors %s. */\nexport interface %s {\n%s}\n\n", t.String(), w.names[t], w.fields(t, "  "))
+	}
+	return b.String()
+}
+
+// tsPropertyName quotes property names that are not valid identifiers.
+func tsPropertyName(name string) string {
+	for i, r := range name {
+		if !(r == '_' || r == '$' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || i > 0 && r >= '0' && r <= '9') {
+			return fmt.Sprintf("%q", name)
+		}
+	}
+	return name
+}
+
+var tsTemplate = template.Must(template.New("ts").Parse(`// Code generated by apimaker. DO NOT EDIT.
+
+{{.Types -}}
+/** The envelope every api_maker endpoint answers with. */
+export interface Response<T> {
+  code: number;
+  success_message: string;
+  error_message: string;
+  data: T;
+  metadata: MetaData;
+}
+
+/** Thrown when the API answers with an error response. */
+export class ApiError extends Error {
+  constructor(public readonly status: number, message: string) {
+    super(message);
+    this.name = "ApiError";
+  }
+}
+
+/** Query options of View and List requests. */
+export interface RequestOptions {
+  fields?: string[];
+  include?: string[];
+}
+
+type Query = Record<string, unknown>;
+
+export class Client {
+  constructor(
+    private readonly baseURL: string,
+    private readonly init: RequestInit = {},
+  ) {}
+
+  async request<T>(method: string, path: string, query?: Query, body?: unknown): Promise<Response<T>> {
+    const url = new URL(this.baseURL.replace(/\/$/, "") + path);
+    for (const [key, value] of Object.entries(query ?? {})) {
+      if (value === undefined || value === null || value === "") continue;
+      for (const item of Array.isArray(value) ? value : [value]) {
+        url.searchParams.append(key, String(item));
+      }
+    }
+
+    const headers = new Headers(this.init.headers);
+    if (body !== undefined) headers.set("Content-Type", "application/json");
+
+    const res = await fetch(url, {
+      ...this.init,
+      method,
+      headers,
+      body: body === undefined ? undefined : JSON.stringify(body),
+    });
+
+    let envelope: Response<T>;
+    try {
+      envelope = (await res.json()) as Response<T>;
+    } catch {
+      throw new ApiError(res.status, res.statusText);
+    }
+    if (!res.ok) throw new ApiError(res.status, envelope.error_message || res.statusText);
+    return envelope;
+  }
+}
+
+function renderOptions(options?: RequestOptions): Query {
+  return {
+    fields: options?.fields?.join(","),
+    include: options?.include?.join(","),
+  };
+}
+{{range $r := .Resources}}
+/** Calls the {{$r.Key}} resource. */
+export class {{$r.Name}}Client {
+  constructor(private readonly client: Client) {}
+{{range $m := $r.Methods}}{{if eq $m.Operation "create"}}
+  async create({{range $m.Params}}{{.}}: string, {{end}}form: {{$m.Form}}): Promise<{{$m.Model}}> {
+    const res = await this.client.request<{ "{{$r.Key}}": {{$m.Model}} }>("{{$m.Method}}", {{$m.Path}}, undefined, form);
+    return res.data["{{$r.Key}}"];
+  }
+{{else if eq $m.Operation "edit"}}
+  async edit({{range $m.Params}}{{.}}: string, {{end}}form: {{$m.Form}}): Promise<{{$m.Model}}> {
+    const res = await this.client.request<{ "{{$r.Key}}": {{$m.Model}} }>("{{$m.Method}}", {{$m.Path}}, undefined, form);
+    return res.data["{{$r.Key}}"];
+  }
+{{else if eq $m.Operation "view"}}
+  async view({{range $m.Params}}{{.}}: string, {{end}}options?: RequestOptions): Promise<{{$m.Model}}> {
+    const res = await this.client.request<{ "{{$r.Key}}": {{$m.Model}} }>("{{$m.Method}}", {{$m.Path}}, renderOptions(options));
+    return res.data["{{$r.Key}}"];
+  }
+{{else if eq $m.Operation "list"}}
+  async list({{range $m.Params}}{{.}}: string, {{end}}{{if $m.Filter}}filter: Partial<{{$m.Filter}}> = {}, {{end}}page: Partial<Pagination> = {}, options?: RequestOptions): Promise<{ items: {{$m.Model}}[]; metadata: MetaData }> {
+    const query = { {{- if $m.Filter}} ...filter,{{end}} ...page, ...renderOptions(options) } as Query;
+    const res = await this.client.request<{ "{{$r.Key}}s": {{$m.Model}}[] }>("{{$m.Method}}", {{$m.Path}}, query);
+    return { items: res.data["{{$r.Key}}s"], metadata: res.metadata };
+  }
+{{else if eq $m.Operation "delete"}}
+  async delete({{range $i, $p := $m.Params}}{{if $i}}, {{end}}{{$p}}: string{{end}}): Promise<void> {
+    await this.client.request<null>("{{$m.Method}}", {{$m.Path}});
+  }
+{{end}}{{end}}}
+{{end}}`))
@@ -0,0 +1,626 @@
+package apimaker
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Headers sent with every webhook delivery.
+const (
+	WebhookIDHeader        = "X-Webhook-ID"
+	WebhookEventHeader     = "X-Webhook-Event"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+	WebhookSignatureHeader = "X-Webhook-Signature"
+)
+
+// ErrWebhookNotFound is returned by a WebhookStore for unknown ids.
+var ErrWebhookNotFound = errors.New("webhook not found")
+
+// WebhookSubscription sends the events of a resource to URL.
+type WebhookSubscription struct {
+	ID       string      `json:"id"`
+	Resource string      `json:"resource"`
+	Events   []EventType `json:"events"`
+	URL      string      `json:"url"`
+	// Secret signs the payloads; it is only returned when the subscription is created.
+	Secret    string    `json:"secret,omitempty"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (s *WebhookSubscription) wants(t EventType) bool {
+	for _, candidate := range s.Events {
+		if candidate == t {
+			return true
+		}
+	}
+	return false
+}
+
+// DeliveryStatus is the state of a webhook delivery.
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliverySucceeded DeliveryStatus = "succeeded"
+	// DeliveryRetrying deliveries failed and wait for their NextAttempt.
+	DeliveryRetrying DeliveryStatus = "retrying"
+	// DeliveryDead deliveries failed MaxAttempts times and are only sent
+	// again when redelivered.
+	DeliveryDead DeliveryStatus = "dead"
+)
+
+// WebhookAttempt logs one try of a delivery.
+type WebhookAttempt struct {
+	At         time.Time     `json:"at"`
+	StatusCode int           `json:"status_code,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	Duration   time.Duration `json:"duration"`
+}
+
+// WebhookDelivery is an event sent to a subscription, with its attempt log.
+type WebhookDelivery struct {
+	ID             string           `json:"id"`
+	SubscriptionID string           `json:"subscription_id"`
+	Event          Event            `json:"event"`
+	Status         DeliveryStatus   `json:"status"`
+	Attempts       []WebhookAttempt `json:"attempts"`
+	NextAttempt    time.Time        `json:"next_attempt,omitempty"`
+	// RedeliveryOf is the id of the delivery this one repeats.
+	RedeliveryOf string    `json:"redelivery_of,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// WebhookStore persists subscriptions and deliveries. Get methods return
+// ErrWebhookNotFound for unknown ids; an empty resource or status matches all.
+type WebhookStore interface {
+	SaveSubscription(sub *WebhookSubscription) error
+	GetSubscription(id string) (*WebhookSubscription, error)
+	DeleteSubscription(id string) error
+	ListSubscriptions(resource string) ([]*WebhookSubscription, error)
+	SaveDelivery(delivery *WebhookDelivery) error
+	GetDelivery(id string) (*WebhookDelivery, error)
+	ListDeliveries(subscriptionID string, status DeliveryStatus) ([]*WebhookDelivery, error)
+}
+
+// MemoryWebhookStore is a WebhookStore kept in memory.
+type MemoryWebhookStore struct {
+	mu            sync.RWMutex
+	subscriptions map[string]WebhookSubscription
+	deliveries    map[string]WebhookDelivery
+}
+
+// NewMemoryWebhookStore creates an empty MemoryWebhookStore.
+func NewMemoryWebhookStore() *MemoryWebhookStore {
+	return &MemoryWebhookStore{
+		subscriptions: map[string]WebhookSubscription{},
+		deliveries:    map[string]WebhookDelivery{},
+	}
+}
+
+func (s *MemoryWebhookStore) SaveSubscription(sub *WebhookSubscription) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	copied := *sub
+	copied.Events = append([]EventType(nil), sub.Events...)
+	s.subscriptions[sub.ID] = copied
+	return nil
+}
+
+func (s *MemoryWebhookStore) GetSubscription(id string) (*WebhookSubscription, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sub, ok := s.subscriptions[id]
+	if !ok {
+		return nil, ErrWebhookNotFound
+	}
+	return &sub, nil
+}
+
+func (s *MemoryWebhookStore) DeleteSubscription(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.subscriptions[id]; !ok {
+		return ErrWebhookNotFound
+	}
+	delete(s.subscriptions, id)
+	return nil
+}
+
+func (s *MemoryWebhookStore) ListSubscriptions(resource string) ([]*WebhookSubscription, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := []*WebhookSubscription{}
+	for _, sub := range s.subscriptions {
+		if resource == "" || sub.Resource == resource {
+			sub := sub
+			list = append(list, &sub)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list, nil
+}
+
+func (s *MemoryWebhookStore) SaveDelivery(delivery *WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	copied := *delivery
+	copied.Attempts = append([]WebhookAttempt(nil), delivery.Attempts...)
+	s.deliveries[delivery.ID] = copied
+	return nil
+}
+
+func (s *MemoryWebhookStore) GetDelivery(id string) (*WebhookDelivery, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	delivery, ok := s.deliveries[id]
+	if !ok {
+		return nil, ErrWebhookNotFound
+	}
+	return &delivery, nil
+}
+
+func (s *MemoryWebhookStore) ListDeliveries(subscriptionID string, status DeliveryStatus) ([]*WebhookDelivery, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := []*WebhookDelivery{}
+	for _, delivery := range s.deliveries {
+		if (subscriptionID == "" || delivery.SubscriptionID == subscriptionID) && (status == "" || delivery.Status == status) {
+			delivery := delivery
+			list = append(list, &delivery)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list, nil
+}
+
+// Webhooks delivers the events of the attached services to the subscribed
+// URLs. Payloads are the JSON encoded Event without its Principal, whose
+// Before and After snapshots only hold the fields anonymous clients may read,
+// or are left out when the service has no NewModel. They are signed with
+// HMAC-SHA256 of "<timestamp>.<body>" using the secret of the subscription;
+// see SignWebhook. Failed deliveries are retried with exponential backoff and
+// dead-lettered after MaxAttempts attempts; Resume sends the deliveries left
+// pending or retrying by a previous process.
+type Webhooks struct {
+	Store  WebhookStore
+	Client *http.Client
+	// MaxAttempts defaults to 5.
+	MaxAttempts int
+	// Backoff is the delay before the first retry, doubled for every further
+	// one; it defaults to one second.
+	Backoff time.Duration
+	Logger  echo.Logger
+
+	mu       sync.RWMutex
+	services map[string]*APIService
+	wg       sync.WaitGroup
+}
+
+// NewWebhooks creates a dispatcher using store.
+func NewWebhooks(store WebhookStore) *Webhooks {
+	return &Webhooks{
+		Store:       store,
+		Client:      &http.Client{Timeout: 10 * time.Second},
+		MaxAttempts: 5,
+		Backoff:     time.Second,
+		services:    map[string]*APIService{},
+	}
+}
+
+// Attach subscribes the dispatcher to the events of the services, which can
+// then be used as the resource of subscriptions.
+func (w *Webhooks) Attach(services ...*APIService) *Webhooks {
+	for _, service := range services {
+		w.mu.Lock()
+		w.services[service.Name] = service
+		w.mu.Unlock()
+
+		service.Events.Subscribe(Subscription{
+			Name:    "webhooks",
+			Async:   true,
+			Handler: w.dispatch,
+		})
+	}
+	return w
+}
+
+// Wait blocks until every delivery in flight, including scheduled retries, is done.
+func (w *Webhooks) Wait() {
+	w.wg.Wait()
+}
+
+// dispatch creates a delivery for every active subscription to the event.
+func (w *Webhooks) dispatch(e Event) error {
+	subs, err := w.Store.ListSubscriptions(e.Resource)
+	if err != nil {
+		return err
+	}
+
+	e, err = w.payload(e)
+	if err != nil {
+		return err
+	}
+
+	for _, sub := range subs {
+		if !sub.Active || !sub.wants(e.Type) {
+			continue
+		}
+
+		delivery := &WebhookDelivery{
+			ID:             newEventID(),
+			SubscriptionID: sub.ID,
+			Event:          e,
+			Status:         DeliveryPending,
+			CreatedAt:      time.Now().UTC(),
+		}
+		if err := w.Store.SaveDelivery(delivery); err != nil {
+			return err
+		}
+		w.schedule(delivery.ID, 0)
+	}
+	return nil
+}
+
+// payload removes the principal and the unreadable fields of the snapshots
+// from an event before it is stored and sent.
+func (w *Webhooks) payload(e Event) (Event, error) {
+	e.Principal = nil
+
+	w.mu.RLock()
+	service := w.services[e.Resource]
+	w.mu.RUnlock()
+	if service == nil || service.NewModel == nil {
+		e.Before, e.After = nil, nil
+		return e, nil
+	}
+
+	// deliveries are rendered for anonymous clients
+	c := NewHTTPContext(nil, nil, nil, nil)
+	model := service.NewModel()
+	var err error
+	if e.Before != nil {
+		if e.Before, err = service.renderValue(c, e.Before, model, nil, nil); err != nil {
+			return e, err
+		}
+	}
+	if e.After != nil {
+		if e.After, err = service.renderValue(c, e.After, model, nil, nil); err != nil {
+			return e, err
+		}
+	}
+	return e, nil
+}
+
+// Resume schedules the pending and retrying deliveries of the store, such as
+// those left by a previous process; retries keep their NextAttempt. It should
+// be called once on start, after the services are attached.
+func (w *Webhooks) Resume() error {
+	now := time.Now()
+	for _, status := range []DeliveryStatus{DeliveryPending, DeliveryRetrying} {
+		deliveries, err := w.Store.ListDeliveries("", status)
+		if err != nil {
+			return err
+		}
+
+		for _, delivery := range deliveries {
+			var delay time.Duration
+			if delivery.NextAttempt.After(now) {
+				delay = delivery.NextAttempt.Sub(now)
+			}
+			w.schedule(delivery.ID, delay)
+		}
+	}
+	return nil
+}
+
+func (w *Webhooks) schedule(id string, delay time.Duration) {
+	w.wg.Add(1)
+	time.AfterFunc(delay, func() {
+		defer w.wg.Done()
+		if err := w.attempt(id); err != nil && w.Logger != nil {
+			w.Logger.Errorf("webhook delivery %s: %v", id, err)
+		}
+	})
+}
+
+// attempt sends a delivery once and records the outcome.
+func (w *Webhooks) attempt(id string) error {
+	delivery, err := w.Store.GetDelivery(id)
+	if err != nil {
+		return err
+	}
+
+	sub, err := w.Store.GetSubscription(delivery.SubscriptionID)
+	if err != nil {
+		delivery.Status = DeliveryDead
+		delivery.Attempts = append(delivery.Attempts, WebhookAttempt{At: time.Now().UTC(), Error: "subscription removed"})
+		return w.Store.SaveDelivery(delivery)
+	}
+
+	started := time.Now()
+	status, err := w.send(sub, delivery)
+	record := WebhookAttempt{At: started.UTC(), StatusCode: status, Duration: time.Since(started)}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	delivery.Attempts = append(delivery.Attempts, record)
+	delivery.NextAttempt = time.Time{}
+
+	maxAttempts := w.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+
+	switch {
+	case err == nil:
+		delivery.Status = DeliverySucceeded
+	case len(delivery.Attempts) >= maxAttempts:
+		delivery.Status = DeliveryDead
+	default:
+		delay := w.Backoff * time.Duration(math.Pow(2, float64(len(delivery.Attempts)-1)))
+		delivery.Status = DeliveryRetrying
+		delivery.NextAttempt = time.Now().Add(delay).UTC()
+		defer w.schedule(delivery.ID, delay)
+	}
+	return w.Store.SaveDelivery(delivery)
+}
+
+// send posts the signed event and treats any non 2xx answer as a failure.
+func (w *Webhooks) send(sub *WebhookSubscription, delivery *WebhookDelivery) (int, error) {
+	body, err := json.Marshal(delivery.Event)
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := time.Now().Unix()
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	req.Header.Set(WebhookIDHeader, delivery.ID)
+	req.Header.Set(WebhookEventHeader, delivery.Event.Resource+"."+string(delivery.Event.Type))
+	req.Header.Set(WebhookTimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(WebhookSignatureHeader, SignWebhook(sub.Secret, timestamp, body))
+
+	client := w.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver answered %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// Redeliver sends the event of a delivery again as a new delivery, which
+// starts a fresh series of attempts.
+func (w *Webhooks) Redeliver(id string) (*WebhookDelivery, error) {
+	original, err := w.Store.GetDelivery(id)
+	if err != nil {
+		return nil, err
+	}
+
+	delivery := &WebhookDelivery{
+		ID:             newEventID(),
+		SubscriptionID: original.SubscriptionID,
+		Event:          original.Event,
+		Status:         DeliveryPending,
+		RedeliveryOf:   original.ID,
+		CreatedAt:      time.Now().UTC(),
+	}
+	if err := w.Store.SaveDelivery(delivery); err != nil {
+		return nil, err
+	}
+	w.schedule(delivery.ID, 0)
+	return delivery, nil
+}
+
+// SignWebhook returns the signature header value of a payload:
+// "sha256=" followed by the hex HMAC-SHA256 of "<timestamp>.<body>".
+func SignWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyWebhook reads the body of a received webhook and checks its signature
+// and, when tolerance is positive, that its timestamp is recent enough.
+func VerifyWebhook(r *http.Request, secret string, tolerance time.Duration) ([]byte, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	timestamp, err := strconv.ParseInt(r.Header.Get(WebhookTimestampHeader), 10, 64)
+	if err != nil {
+		return nil, errors.New("invalid webhook timestamp")
+	}
+
+	if tolerance > 0 && time.Since(time.Unix(timestamp, 0)).Abs() > tolerance {
+		return nil, errors.New("webhook timestamp outside tolerance")
+	}
+
+	expected := SignWebhook(secret, timestamp, body)
+	if !hmac.Equal([]byte(expected), []byte(r.Header.Get(WebhookSignatureHeader))) {
+		return nil, errors.New("invalid webhook signature")
+	}
+	return body, nil
+}
+
+// WebhookForm creates a subscription. A secret is generated when none is given.
+type WebhookForm struct {
+	Resource string      `json:"resource" validate:"required"`
+	Events   []EventType `json:"events" validate:"required,min=1,dive,oneof=created updated deleted viewed listed"`
+	URL      string      `json:"url" validate:"required,url"`
+	Secret   string      `json:"secret"`
+}
+
+// Register adds the management endpoints below /webhooks of mux:
+//
+//	POST   /webhooks/subscriptions                 create a subscription
+//	GET    /webhooks/subscriptions                 list subscriptions, ?resource= filters
+//	GET    /webhooks/subscriptions/:id             view a subscription
+//	DELETE /webhooks/subscriptions/:id             delete a subscription
+//	GET    /webhooks/subscriptions/:id/deliveries  delivery log, ?status=dead lists dead letters
+//	GET    /webhooks/deliveries/:id                view a delivery
+//	POST   /webhooks/deliveries/:id/redeliver      send a delivery again
+//
+// The endpoints run through the stage pipeline of an APIService named
+// "webhook", which is returned so that interceptors can be added. They are
+// guarded by security, or when it is empty by the Security of the
+// ResourceConfig of the returned service; requests are refused when neither
+// is set.
+func (w *Webhooks) Register(mux Mux, security Security, validator echo.Validator) *APIService {
+	service := NewAPIServiceWithMux("webhook", mux.Group("/webhooks"), validator, w.Logger)
+
+	handle := func(method, path string, operation Operation, respond func(s *State) error) {
+		service.Mux.Handle(method, path, func(c Context) error {
+			state := &State{Operation: operation, Service: service, Context: c, Security: service.securityFor(operation, security), ID: c.Param("id")}
+			return service.run(state, []Stage{
+				adminAuthenticateStage(),
+				authorizeStage(),
+				{Name: StageRespond, Run: respond},
+			}, nil)
+		})
+	}
+
+	handle(http.MethodPost, "/subscriptions", OperationCreate, func(s *State) error {
+		form := new(WebhookForm)
+		if err := s.Context.Bind(form); err != nil {
+			return NewStageError(http.StatusBadRequest, err, "failed to bind form")
+		}
+		if err := s.Context.Validate(form); err != nil {
+			return NewStageError(http.StatusBadRequest, err, "failed to bind form")
+		}
+
+		w.mu.RLock()
+		_, known := w.services[form.Resource]
+		w.mu.RUnlock()
+		if !known {
+			return NewStageError(http.StatusBadRequest, fmt.Errorf("unknown resource %q", form.Resource), "invalid resource")
+		}
+
+		if u, err := url.Parse(form.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return NewStageError(http.StatusBadRequest, fmt.Errorf("invalid url %q", form.URL), "invalid url")
+		}
+
+		sub := &WebhookSubscription{
+			ID:        newEventID(),
+			Resource:  form.Resource,
+			Events:    form.Events,
+			URL:       form.URL,
+			Secret:    form.Secret,
+			Active:    true,
+			CreatedAt: time.Now().UTC(),
+		}
+		if sub.Secret == "" {
+			sub.Secret = newWebhookSecret()
+		}
+
+		if err := w.Store.SaveSubscription(sub); err != nil {
+			return NewStageError(http.StatusInternalServerError, err, "cannot add webhook")
+		}
+		return SuccessResponse(s.Context, http.StatusOK, "successfully added webhook", echo.Map{"webhook": sub}, MetaData{})
+	})
+
+	handle(http.MethodGet, "/subscriptions", OperationList, func(s *State) error {
+		subs, err := w.Store.ListSubscriptions(s.Context.QueryParam("resource"))
+		if err != nil {
+			return NewStageError(http.StatusInternalServerError, err, "cannot find any webhook")
+		}
+		for _, sub := range subs {
+			sub.Secret = ""
+		}
+		return SuccessResponse(s.Context, http.StatusOK, "successfully loaded webhook list", echo.Map{"webhooks": subs}, MetaData{TotalCounts: len(subs)})
+	})
+
+	handle(http.MethodGet, "/subscriptions/:id", OperationView, func(s *State) error {
+		sub, err := w.Store.GetSubscription(s.ID)
+		if err != nil {
+			return webhookLookupError(err)
+		}
+		sub.Secret = ""
+		return SuccessResponse(s.Context, http.StatusOK, "successfully loaded webhook", echo.Map{"webhook": sub}, MetaData{})
+	})
+
+	handle(http.MethodDelete, "/subscriptions/:id", OperationDelete, func(s *State) error {
+		if err := w.Store.DeleteSubscription(s.ID); err != nil {
+			return webhookLookupError(err)
+		}
+		return SuccessResponse(s.Context, http.StatusOK, "successfully removed", nil, MetaData{})
+	})
+
+	handle(http.MethodGet, "/subscriptions/:id/deliveries", OperationList, func(s *State) error {
+		if _, err := w.Store.GetSubscription(s.ID); err != nil {
+			return webhookLookupError(err)
+		}
+
+		deliveries, err := w.Store.ListDeliveries(s.ID, DeliveryStatus(s.Context.QueryParam("status")))
+		if err != nil {
+			return NewStageError(http.StatusInternalServerError, err, "cannot find any delivery")
+		}
+		return SuccessResponse(s.Context, http.StatusOK, "successfully loaded delivery list", echo.Map{"deliveries": deliveries}, MetaData{TotalCounts: len(deliveries)})
+	})
+
+	handle(http.MethodGet, "/deliveries/:id", OperationView, func(s *State) error {
+		delivery, err := w.Store.GetDelivery(s.ID)
+		if err != nil {
+			return webhookLookupError(err)
+		}
+		return SuccessResponse(s.Context, http.StatusOK, "successfully loaded delivery", echo.Map{"delivery": delivery}, MetaData{})
+	})
+
+	handle(http.MethodPost, "/deliveries/:id/redeliver", Operation("redeliver"), func(s *State) error {
+		delivery, err := w.Redeliver(s.ID)
+		if err != nil {
+			return webhookLookupError(err)
+		}
+		return SuccessResponse(s.Context, http.StatusOK, "successfully scheduled redelivery", echo.Map{"delivery": delivery}, MetaData{})
+	})
+
+	return service
+}
+
+func webhookLookupError(err error) error {
+	if errors.Is(err, ErrWebhookNotFound) {
+		return NewStageError(http.StatusNotFound, err, "webhook not found")
+	}
+	return NewStageError(http.StatusInternalServerError, err, "cannot load webhook")
+}
+
+func newWebhookSecret() string {
+	var b [32]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "whsec_" + newEventID()
+	}
+	return "whsec_" + hex.EncodeToString(b[:])
+}
@@ -0,0 +1,171 @@
+package apimaker
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// secretItem has a field only admins may read.
+type secretItem struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Secret string `json:"secret" api:"read=admin"`
+}
+
+func (m *secretItem) Save() error                 { return nil }
+func (m *secretItem) GetOne(id interface{}) error { return ErrRecordNotFound }
+func (m *secretItem) Remove(id interface{}) error { return nil }
+func (m *secretItem) List(filter Filter, pagination Pagination) (int, int, interface{}, error) {
+	return 0, 0, []secretItem{}, nil
+}
+
+// webhookReceiver records the verified payloads it receives after answering
+// the first failures requests with 500.
+type webhookReceiver struct {
+	mu       sync.Mutex
+	secret   string
+	failures int
+	calls    int
+	events   []Event
+	errs     []error
+}
+
+func (r *webhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls++
+	if r.calls <= r.failures {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	body, err := VerifyWebhook(req, r.secret, time.Minute)
+	if err != nil {
+		r.errs = append(r.errs, err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	var e Event
+	if err := json.Unmarshal(body, &e); err != nil {
+		r.errs = append(r.errs, err)
+	}
+	r.events = append(r.events, e)
+}
+
+func newTestWebhooks(t *testing.T, receiver *webhookReceiver) (*Webhooks, *APIService) {
+	t.Helper()
+	server := httptest.NewServer(receiver)
+	t.Cleanup(server.Close)
+
+	service := NewHTTPAPIService("secret", http.NewServeMux(), "/secret", testValidator{}, nil)
+	service.NewModel = func() Model { return new(secretItem) }
+
+	webhooks := NewWebhooks(NewMemoryWebhookStore())
+	webhooks.Backoff = time.Millisecond
+	webhooks.Attach(service)
+	if err := webhooks.Store.SaveSubscription(&WebhookSubscription{
+		ID:       "sub",
+		Resource: "secret",
+		Events:   []EventType{EventCreated},
+		URL:      server.URL,
+		Secret:   receiver.secret,
+		Active:   true,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return webhooks, service
+}
+
+func TestWebhookDeliveryIsSignedAndRetried(t *testing.T) {
+	receiver := &webhookReceiver{secret: "whsec_test", failures: 1}
+	webhooks, service := newTestWebhooks(t, receiver)
+
+	if err := service.Events.Publish(Event{
+		Type:      EventCreated,
+		Resource:  "secret",
+		RecordID:  "1",
+		After:     &secretItem{ID: "1", Name: "a", Secret: "hidden"},
+		Principal: &Principal{ID: "alice", Claims: map[string]interface{}{"token": "t"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	service.Events.Wait()
+	webhooks.Wait()
+
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+	if len(receiver.errs) > 0 {
+		t.Fatal(receiver.errs)
+	}
+	if receiver.calls != 2 || len(receiver.events) != 1 {
+		t.Fatalf("receiver got %d calls and %d events, want a retry after the 500", receiver.calls, len(receiver.events))
+	}
+
+	e := receiver.events[0]
+	if e.Principal != nil {
+		t.Errorf("payload has the principal %+v", e.Principal)
+	}
+	after, _ := e.After.(map[string]interface{})
+	if after["name"] != "a" || after["secret"] != nil {
+		t.Errorf("payload snapshot = %v, want the readable fields only", e.After)
+	}
+
+	deliveries, _ := webhooks.Store.ListDeliveries("sub", DeliverySucceeded)
+	if len(deliveries) != 1 || len(deliveries[0].Attempts) != 2 {
+		t.Errorf("deliveries = %+v, want one succeeded after two attempts", deliveries)
+	}
+}
+
+func TestVerifyWebhookRejectsWrongSignature(t *testing.T) {
+	body := `{"id":"1"}`
+	received := func(secret string, timestamp int64) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		r.Header.Set(WebhookTimestampHeader, strconv.FormatInt(timestamp, 10))
+		r.Header.Set(WebhookSignatureHeader, SignWebhook(secret, timestamp, []byte(body)))
+		return r
+	}
+
+	now := time.Now().Unix()
+	if _, err := VerifyWebhook(received("whsec_test", now), "whsec_test", time.Minute); err != nil {
+		t.Errorf("valid payload rejected: %v", err)
+	}
+	if _, err := VerifyWebhook(received("other", now), "whsec_test", time.Minute); err == nil {
+		t.Error("payload signed with another secret verified")
+	}
+	if _, err := VerifyWebhook(received("whsec_test", now-3600), "whsec_test", time.Minute); err == nil {
+		t.Error("payload outside the tolerance verified")
+	}
+}
+
+func TestWebhooksResumePendingDeliveries(t *testing.T) {
+	receiver := &webhookReceiver{secret: "whsec_test"}
+	webhooks, _ := newTestWebhooks(t, receiver)
+	if err := webhooks.Store.SaveDelivery(&WebhookDelivery{
+		ID:             "left",
+		SubscriptionID: "sub",
+		Event:          Event{Type: EventCreated, Resource: "secret", RecordID: "1"},
+		Status:         DeliveryRetrying,
+		NextAttempt:    time.Now().Add(time.Millisecond),
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := webhooks.Resume(); err != nil {
+		t.Fatal(err)
+	}
+	webhooks.Wait()
+
+	delivery, err := webhooks.Store.GetDelivery("left")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delivery.Status != DeliverySucceeded {
+		t.Errorf("resumed delivery = %s, want succeeded", delivery.Status)
+	}
+}